@@ -11,6 +11,7 @@ import (
 type Broadcaster struct {
 	mu      sync.RWMutex
 	writers map[io.WriteCloser]struct{}
+	closed  bool
 }
 
 func NewBroadcaster() *Broadcaster {
@@ -21,8 +22,14 @@ func NewBroadcaster() *Broadcaster {
 
 func (this *Broadcaster) Add(w io.WriteCloser) {
 	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	// Nothing is going to be written anymore, don't leave the writer hanging.
+	if this.closed {
+		w.Close()
+		return
+	}
 	this.writers[w] = struct{}{}
-	this.mu.Unlock()
 }
 
 func (this *Broadcaster) Remove(w io.WriteCloser) {
@@ -52,13 +59,16 @@ func (this *Broadcaster) Write(p []byte) (n int, err error) {
 
 func (this *Broadcaster) Run(r io.Reader) error {
 	_, err := io.Copy(this, r)
-	this.removeAll()
+	this.Close()
 	return err
 }
 
-func (this *Broadcaster) removeAll() {
+// Closes all the writers, writers added afterwards get closed immediately.
+func (this *Broadcaster) Close() {
 	this.mu.Lock()
 	defer this.mu.Unlock()
+
+	this.closed = true
 	for w := range this.writers {
 		this.remove(w)
 	}
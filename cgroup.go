@@ -0,0 +1,325 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/thekhanj/ella/config"
+)
+
+// How long to wait for the processes of a killed cgroup to go away.
+const cgroupKillTimeout = 5 * time.Second
+
+// Controllers ella enables for the cgroups of the services.
+var cgroupControllers = []string{"cpu", "io", "memory", "pids"}
+
+// A value written into one of the control files of a cgroup, e.g. memory.max.
+type CgroupControl struct {
+	File  string
+	Value string
+}
+
+func (this CgroupControl) Controller() string {
+	controller, _, _ := strings.Cut(this.File, ".")
+	return controller
+}
+
+// The delegated cgroup v2 the cgroups of the services are created in.
+type CgroupRoot struct {
+	path        string
+	controllers map[string]bool
+}
+
+func (this *CgroupRoot) HasController(controller string) bool {
+	return this.controllers[controller]
+}
+
+func (this *CgroupRoot) Service(name string, controls []CgroupControl) *Cgroup {
+	return &Cgroup{
+		path:     filepath.Join(this.path, name+".service"),
+		controls: controls,
+	}
+}
+
+// The cgroup the processes of a service get spawned into. It gets created
+// right before spawning a process and removed after the process has exited.
+type Cgroup struct {
+	path     string
+	controls []CgroupControl
+}
+
+func (this *Cgroup) Create() error {
+	err := os.Mkdir(this.path, 0755)
+	if err != nil && !errors.Is(err, os.ErrExist) {
+		return err
+	}
+
+	for _, c := range this.controls {
+		err := this.write(c.File, c.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Kills every process left in the cgroup and removes it.
+func (this *Cgroup) Remove() error {
+	err := this.kill()
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(cgroupKillTimeout)
+	for {
+		err := syscall.Rmdir(this.path)
+		if err == nil || errors.Is(err, syscall.ENOENT) {
+			return nil
+		}
+		if !errors.Is(err, syscall.EBUSY) || time.Now().After(deadline) {
+			return err
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (this *Cgroup) kill() error {
+	err := this.write("cgroup.kill", "1")
+	if err == nil || !this.exists() {
+		return nil
+	}
+	// Kernels older than 5.14 don't have cgroup.kill.
+	if errors.Is(err, os.ErrNotExist) {
+		return this.killProcs()
+	}
+
+	return err
+}
+
+func (this *Cgroup) killProcs() error {
+	pids, err := this.Pids()
+	if err != nil {
+		return err
+	}
+
+	for _, pid := range pids {
+		syscall.Kill(pid, syscall.SIGKILL)
+	}
+	return nil
+}
+
+func (this *Cgroup) Pids() ([]int, error) {
+	f, err := os.Open(filepath.Join(this.path, "cgroup.procs"))
+	if errors.Is(err, os.ErrNotExist) {
+		return []int{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pids := make([]int, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		pid, err := strconv.Atoi(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		pids = append(pids, pid)
+	}
+
+	return pids, scanner.Err()
+}
+
+// Resources used by the processes of a cgroup, values not accounted because
+// of a missing controller are -1.
+type CgroupStats struct {
+	Tasks   int
+	Memory  int64
+	CpuTime time.Duration
+}
+
+func (this *CgroupStats) String() string {
+	ret := fmt.Sprintf("tasks %d", this.Tasks)
+	if this.Memory >= 0 {
+		ret += fmt.Sprintf(", memory %.1fMiB", float64(this.Memory)/(1<<20))
+	}
+	if this.CpuTime >= 0 {
+		ret += fmt.Sprintf(", cpu %s", this.CpuTime.Round(time.Millisecond))
+	}
+	return ret
+}
+
+func (this *Cgroup) Stats() (*CgroupStats, error) {
+	if !this.exists() {
+		return nil, os.ErrNotExist
+	}
+
+	pids, err := this.Pids()
+	if err != nil {
+		return nil, err
+	}
+	stats := &CgroupStats{
+		Tasks:   len(pids),
+		Memory:  -1,
+		CpuTime: -1,
+	}
+
+	if v, err := this.read("memory.current"); err == nil {
+		stats.Memory, _ = strconv.ParseInt(v, 10, 64)
+	}
+	if v, err := this.read("cpu.stat"); err == nil {
+		for _, line := range strings.Split(v, "\n") {
+			usec, ok := strings.CutPrefix(line, "usage_usec ")
+			if !ok {
+				continue
+			}
+			n, _ := strconv.ParseInt(usec, 10, 64)
+			stats.CpuTime = time.Duration(n) * time.Microsecond
+		}
+	}
+
+	return stats, nil
+}
+
+func (this *Cgroup) exists() bool {
+	_, err := os.Stat(this.path)
+	return err == nil
+}
+
+func (this *Cgroup) read(file string) (string, error) {
+	b, err := os.ReadFile(filepath.Join(this.path, file))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
+
+func (this *Cgroup) write(file, value string) error {
+	err := writeCgroupFile(filepath.Join(this.path, file), value)
+	if err != nil {
+		return fmt.Errorf("cgroup: writing %s failed: %w", file, err)
+	}
+
+	return nil
+}
+
+// Control files can't be created, so unlike os.WriteFile there is no
+// O_CREATE.
+func writeCgroupFile(path, value string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteString(value)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+func NewCgroupControlsFromConfig(
+	cfg *config.Resources,
+) ([]CgroupControl, error) {
+	controls := make([]CgroupControl, 0)
+	if cfg == nil {
+		return controls, nil
+	}
+
+	if cfg.MemoryMax != nil {
+		v, err := parseCgroupSize(string(*cfg.MemoryMax))
+		if err != nil {
+			return nil, err
+		}
+		controls = append(controls, CgroupControl{"memory.max", v})
+	}
+	if cfg.MemoryHigh != nil {
+		v, err := parseCgroupSize(string(*cfg.MemoryHigh))
+		if err != nil {
+			return nil, err
+		}
+		controls = append(controls, CgroupControl{"memory.high", v})
+	}
+	if cfg.CpuWeight != nil {
+		controls = append(controls, CgroupControl{
+			"cpu.weight", strconv.Itoa(*cfg.CpuWeight),
+		})
+	}
+	if cfg.CpuMax != nil {
+		v, err := parseCgroupCpuMax(*cfg.CpuMax)
+		if err != nil {
+			return nil, err
+		}
+		controls = append(controls, CgroupControl{"cpu.max", v})
+	}
+	if cfg.PidsMax != nil {
+		controls = append(controls, CgroupControl{
+			"pids.max", strconv.Itoa(*cfg.PidsMax),
+		})
+	}
+	if cfg.IoWeight != nil {
+		controls = append(controls, CgroupControl{
+			"io.weight", fmt.Sprintf("default %d", *cfg.IoWeight),
+		})
+	}
+
+	return controls, nil
+}
+
+// Converts sizes like 512M into bytes, max is kept as it is.
+func parseCgroupSize(size string) (string, error) {
+	if size == "max" {
+		return size, nil
+	}
+
+	units := map[byte]int64{'K': 1 << 10, 'M': 1 << 20, 'G': 1 << 30, 'T': 1 << 40}
+	n, mul := size, int64(1)
+	if len(size) > 0 {
+		if unit, ok := units[size[len(size)-1]]; ok {
+			n, mul = size[:len(size)-1], unit
+		}
+	}
+
+	v, err := strconv.ParseInt(n, 10, 64)
+	if err != nil || v < 0 {
+		return "", fmt.Errorf("invalid size: %s", size)
+	}
+
+	return strconv.FormatInt(v*mul, 10), nil
+}
+
+// Period of cpu.max the quota is calculated for.
+const cgroupCpuPeriod = 100000
+
+// Converts percentages of a single cpu, e.g. 150%, into cpu.max values.
+func parseCgroupCpuMax(cpuMax string) (string, error) {
+	if cpuMax == "max" {
+		return fmt.Sprintf("max %d", cgroupCpuPeriod), nil
+	}
+
+	percent, ok := strings.CutSuffix(cpuMax, "%")
+	if !ok {
+		return "", fmt.Errorf("invalid cpu max: %s", cpuMax)
+	}
+	v, err := strconv.ParseFloat(percent, 64)
+	if err != nil || v <= 0 {
+		return "", fmt.Errorf("invalid cpu max: %s", cpuMax)
+	}
+
+	quota := max(int64(v*cgroupCpuPeriod/100), 1000)
+	return fmt.Sprintf("%d %d", quota, cgroupCpuPeriod), nil
+}
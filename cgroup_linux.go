@@ -0,0 +1,126 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// Finds the cgroup v2 ella is running in and prepares it for the cgroups of
+// the services. Ella moves itself into a leaf cgroup, otherwise controllers
+// can't be enabled for the subtree.
+func NewCgroupRoot() (*CgroupRoot, error) {
+	mount, err := findCgroup2Mount()
+	if err != nil {
+		return nil, err
+	}
+	own, err := findOwnCgroup()
+	if err != nil {
+		return nil, err
+	}
+
+	root := &CgroupRoot{
+		path:        filepath.Join(mount, own),
+		controllers: make(map[string]bool),
+	}
+
+	leaf := filepath.Join(root.path, "ella")
+	err = os.Mkdir(leaf, 0755)
+	if err != nil && !errors.Is(err, os.ErrExist) {
+		return nil, err
+	}
+	err = writeCgroupFile(
+		filepath.Join(leaf, "cgroup.procs"), fmt.Sprint(os.Getpid()),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(filepath.Join(root.path, "cgroup.controllers"))
+	if err != nil {
+		return nil, err
+	}
+	available := strings.Fields(string(b))
+	for _, c := range cgroupControllers {
+		if !slices.Contains(available, c) {
+			continue
+		}
+
+		err := writeCgroupFile(
+			filepath.Join(root.path, "cgroup.subtree_control"), "+"+c,
+		)
+		if err == nil {
+			root.controllers[c] = true
+		}
+	}
+
+	return root, nil
+}
+
+func findCgroup2Mount() (string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// See proc(5), the filesystem type comes right after the separator.
+		fields := strings.Fields(scanner.Text())
+		for i, field := range fields {
+			if field == "-" && i+1 < len(fields) && fields[i+1] == "cgroup2" {
+				return fields[4], nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", errors.New("cgroup v2 is not mounted")
+}
+
+func findOwnCgroup() (string, error) {
+	b, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(string(b), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			return path, nil
+		}
+	}
+
+	return "", errors.New("not running in a cgroup v2")
+}
+
+// Makes the command get spawned right into the cgroup, so none of its
+// children can escape it, the returned function has to be called after the
+// command has started.
+func (this *Cgroup) attach(cmd *exec.Cmd) (func(), error) {
+	fd, err := syscall.Open(this.path, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = fd
+
+	return func() { syscall.Close(fd) }, nil
+}
@@ -0,0 +1,21 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+var cgroupErrUnsupported = errors.New("cgroups are only supported on linux")
+
+func NewCgroupRoot() (*CgroupRoot, error) {
+	return nil, cgroupErrUnsupported
+}
+
+func (this *Cgroup) attach(cmd *exec.Cmd) (func(), error) {
+	return nil, cgroupErrUnsupported
+}
@@ -0,0 +1,59 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import "testing"
+
+func TestParseCgroupSize(t *testing.T) {
+	tests := map[string]string{
+		"max":  "max",
+		"1024": "1024",
+		"512K": "524288",
+		"64M":  "67108864",
+		"2G":   "2147483648",
+	}
+	for size, expected := range tests {
+		v, err := parseCgroupSize(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != expected {
+			t.Errorf(
+				"unexpected size of %s: expected: %s received: %s",
+				size, expected, v,
+			)
+		}
+	}
+
+	_, err := parseCgroupSize("12X")
+	if err == nil {
+		t.Error("expected an error for an invalid size")
+	}
+}
+
+func TestParseCgroupCpuMax(t *testing.T) {
+	tests := map[string]string{
+		"max":  "max 100000",
+		"50%":  "50000 100000",
+		"250%": "250000 100000",
+		"0.1%": "1000 100000",
+	}
+	for cpuMax, expected := range tests {
+		v, err := parseCgroupCpuMax(cpuMax)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != expected {
+			t.Errorf(
+				"unexpected cpu max of %s: expected: %s received: %s",
+				cpuMax, expected, v,
+			)
+		}
+	}
+
+	_, err := parseCgroupCpuMax("50")
+	if err == nil {
+		t.Error("expected an error for a cpu max without percent")
+	}
+}
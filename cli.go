@@ -4,7 +4,9 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
@@ -41,10 +43,15 @@ func (this *Cli) Exec() int {
 		fmt.Fprintln(os.Stderr, "Available Commands:")
 		fmt.Fprintln(os.Stderr, "  run       run the daemon")
 		fmt.Fprintln(os.Stderr, "  logs      show service logs")
+		fmt.Fprintln(os.Stderr, "  status    show status of services")
+		fmt.Fprintln(os.Stderr, "  failures  show last failures of services")
+		fmt.Fprintln(os.Stderr, "  history   show past process runs of services")
+		fmt.Fprintln(os.Stderr, "  show      show how processes of services are spawned")
 		fmt.Fprintln(os.Stderr, "  start     start services")
 		fmt.Fprintln(os.Stderr, "  stop      stop services")
 		fmt.Fprintln(os.Stderr, "  restart   restart services")
 		fmt.Fprintln(os.Stderr, "  reload    reload services")
+		fmt.Fprintln(os.Stderr, "  scale     change the number of replicas of a service")
 		fmt.Fprintln(os.Stderr, "  list      list services")
 		fmt.Fprintln(os.Stderr, "  schema    show http address of config's json schema")
 		fmt.Fprintln(os.Stderr)
@@ -78,15 +85,26 @@ func (this *Cli) Exec() int {
 	case "run":
 		c := RunCli{args: f.Args()[1:]}
 		return c.Exec()
-	case "logs", "start", "stop", "restart", "reload":
+	case "logs", "status", "failures", "history", "start", "stop", "reload":
 		msg := map[string]string{
-			"logs":    "show logs for all services",
-			"start":   "start all services",
-			"stop":    "stop all services",
-			"restart": "restart all services",
-			"reload":  "reload all services",
+			"logs":     "show logs for all services",
+			"status":   "show status of all services",
+			"failures": "show failures of all services",
+			"history":  "show history of all services",
+			"start":    "start all services",
+			"stop":     "stop all services",
+			"reload":   "reload all services",
 		}
 		return runCliAction(this.args[1:], cmd, msg[cmd])
+	case "restart":
+		c := RestartCli{args: f.Args()[1:]}
+		return c.Exec()
+	case "show":
+		c := ShowCli{args: f.Args()[1:]}
+		return c.Exec()
+	case "scale":
+		c := ScaleCli{args: f.Args()[1:]}
+		return c.Exec()
 	case "list":
 		c := ListCli{args: f.Args()[1:]}
 		return c.Exec()
@@ -141,7 +159,9 @@ func (this *RunCli) Exec() int {
 	var serviceNames []string
 	if *all {
 		for _, s := range c.Services {
-			serviceNames = append(serviceNames, s.Name)
+			if !s.IsTemplate() {
+				serviceNames = append(serviceNames, s.Name)
+			}
 		}
 	} else {
 		serviceNames = f.Args()
@@ -165,10 +185,12 @@ func getDaemonPid(pidFile *string) (int, int) {
 	return pid, CODE_SUCCESS
 }
 
+// actionArgs are passed to the action before the services.
 func runCliAction(
 	args []string,
 	action string,
 	allMsg string,
+	actionArgs ...string,
 ) int {
 	f := flag.NewFlagSet("ella", flag.ExitOnError)
 	configPath := f.String("c", "ella.json", "config file")
@@ -200,11 +222,24 @@ func runCliAction(
 		return CODE_INVALID_CONFIG
 	}
 
+	ctx := common.NewSignalCtx(context.Background())
+
+	pid, code := getDaemonPid(c.PidFile)
+	if code != CODE_SUCCESS {
+		return code
+	}
+	socket := SocketClient{pid}
+
 	var serviceNames []string
 	if *all {
-		for _, s := range c.Services {
-			serviceNames = append(serviceNames, s.Name)
+		// Instances of the template services only exist in the daemon.
+		var b bytes.Buffer
+		err = socket.RunCommand(ctx, &b, "list")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return CODE_GENERAL_ERR
 		}
+		serviceNames = strings.Fields(b.String())
 	} else {
 		serviceNames = f.Args()
 	}
@@ -214,6 +249,203 @@ func runCliAction(
 		return CODE_INVALID_INVOKATION
 	}
 
+	err = socket.RunCommand(
+		ctx, os.Stdout, action, append(actionArgs, serviceNames...)...,
+	)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return CODE_GENERAL_ERR
+	}
+
+	return CODE_SUCCESS
+}
+
+type RestartCli struct {
+	args []string
+}
+
+func (this *RestartCli) Exec() int {
+	f := flag.NewFlagSet("ella", flag.ExitOnError)
+	configPath := f.String("c", "ella.json", "config file")
+	all := f.Bool("a", false, "restart all services")
+	rolling := f.Bool(
+		"rolling", false,
+		"restart the services a few at a time, waiting for them to become active",
+	)
+	maxUnavailable := f.Int(
+		"max-unavailable", rollingRestartMaxUnavailable,
+		"number of services restarted at a time in a rolling restart",
+	)
+	timeout := f.Duration(
+		"ready-timeout", rollingRestartReadyTimeout,
+		"how long a rolling restart waits for a service to become active",
+	)
+	minReady := f.Duration(
+		"min-ready", rollingRestartMinReady,
+		"how long a service has to stay active to count as restarted",
+	)
+	help := f.Bool("h", false, "show help")
+
+	f.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  ella restart -c ella.json -a")
+		fmt.Fprintln(os.Stderr, "  ella restart -c ella.json [services...]")
+		fmt.Fprintln(os.Stderr, "  ella restart -c ella.json --rolling [services...]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		f.PrintDefaults()
+	}
+
+	f.Parse(this.args)
+
+	if *help {
+		f.Usage()
+
+		return CODE_SUCCESS
+	}
+
+	if !*rolling {
+		return runCliAction(this.args, "restart", "restart all services")
+	}
+	if *maxUnavailable < 1 {
+		fmt.Fprintf(
+			os.Stderr, "error: invalid max unavailable: %d\n", *maxUnavailable,
+		)
+
+		return CODE_INVALID_INVOKATION
+	}
+
+	args := []string{"-c", *configPath}
+	if *all {
+		args = append(args, "-a")
+	}
+	return runCliAction(
+		append(args, f.Args()...), "rolling-restart", "restart all services",
+		fmt.Sprintf("-max-unavailable=%d", *maxUnavailable),
+		fmt.Sprintf("-ready-timeout=%s", *timeout),
+		fmt.Sprintf("-min-ready=%s", *minReady),
+	)
+}
+
+type ShowCli struct {
+	args []string
+}
+
+func (this *ShowCli) Exec() int {
+	f := flag.NewFlagSet("ella", flag.ExitOnError)
+	configPath := f.String("c", "ella.json", "config file")
+	all := f.Bool("a", false, "show all services")
+	resolved := f.Bool(
+		"resolved", false,
+		"show the services with their templates and include defaults applied",
+	)
+	help := f.Bool("h", false, "show help")
+
+	f.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  ella show -c ella.json -a")
+		fmt.Fprintln(os.Stderr, "  ella show -c ella.json [services...]")
+		fmt.Fprintln(os.Stderr, "  ella show -c ella.json --resolved [services...]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		f.PrintDefaults()
+	}
+
+	f.Parse(this.args)
+
+	if *help {
+		f.Usage()
+
+		return CODE_SUCCESS
+	}
+
+	if !*resolved {
+		return runCliAction(this.args, "show", "show all services")
+	}
+
+	var c config.Config
+
+	err := config.ReadParsedConfig(*configPath, &c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error: invalid config:", err)
+		return CODE_INVALID_CONFIG
+	}
+
+	services := make([]config.Service, 0)
+	if *all {
+		services = c.Services
+	} else {
+		for _, name := range f.Args() {
+			s, ok := c.GetService(name)
+			if !ok {
+				fmt.Fprintf(os.Stderr, "error: service not found: %s\n", name)
+				return CODE_INVALID_INVOKATION
+			}
+			services = append(services, s)
+		}
+	}
+	if len(services) == 0 {
+		fmt.Fprintln(os.Stderr, "error: no service name specified")
+
+		return CODE_INVALID_INVOKATION
+	}
+
+	// The services are decoded from the config, so no secret is read.
+	b, err := json.MarshalIndent(services, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return CODE_GENERAL_ERR
+	}
+	fmt.Println(string(b))
+
+	return CODE_SUCCESS
+}
+
+type ScaleCli struct {
+	args []string
+}
+
+func (this *ScaleCli) Exec() int {
+	f := flag.NewFlagSet("ella", flag.ExitOnError)
+	configPath := f.String("c", "ella.json", "config file")
+	help := f.Bool("h", false, "show help")
+
+	f.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  ella scale -c ella.json <service> <replicas>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		f.PrintDefaults()
+	}
+
+	f.Parse(this.args)
+
+	if *help {
+		f.Usage()
+
+		return CODE_SUCCESS
+	}
+
+	if len(f.Args()) != 2 {
+		f.Usage()
+		fmt.Fprintln(os.Stderr, "error: expected a service and a number of replicas")
+
+		return CODE_INVALID_INVOKATION
+	}
+	if n, err := strconv.Atoi(f.Arg(1)); err != nil || n < 0 {
+		fmt.Fprintf(os.Stderr, "error: invalid number of replicas: %s\n", f.Arg(1))
+
+		return CODE_INVALID_INVOKATION
+	}
+
+	var c config.Config
+
+	err := config.ReadParsedConfig(*configPath, &c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error: invalid config:", err)
+		return CODE_INVALID_CONFIG
+	}
+
 	ctx := common.NewSignalCtx(context.Background())
 
 	pid, code := getDaemonPid(c.PidFile)
@@ -221,9 +453,9 @@ func runCliAction(
 		return code
 	}
 	socket := SocketClient{pid}
-	err = socket.RunCommand(ctx, os.Stdout, action, serviceNames...)
+	err = socket.RunCommand(ctx, os.Stdout, "scale", f.Args()...)
 	if err != nil {
-		fmt.Sprintln(os.Stderr, "error:", err)
+		fmt.Fprintln(os.Stderr, "error:", err)
 		return CODE_GENERAL_ERR
 	}
 
@@ -278,7 +510,7 @@ func (this *ListCli) Exec() int {
 	socket := SocketClient{pid}
 	err = socket.RunCommand(ctx, os.Stdout, "list")
 	if err != nil {
-		fmt.Sprintln(os.Stderr, "error:", err)
+		fmt.Fprintln(os.Stderr, "error:", err)
 		return CODE_GENERAL_ERR
 	}
 
@@ -310,6 +542,10 @@ func (this *SchemaCli) Exec() int {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == procAttrHelperCmd {
+		os.Exit(RunProcAttrHelper(os.Args[2:]))
+	}
+
 	c := Cli{args: os.Args[1:]}
 	os.Exit(c.Exec())
 }
@@ -5,12 +5,14 @@ package common
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
+	"os/user"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -81,47 +83,6 @@ func NewSignalCtx(
 	return ctx
 }
 
-// chatgpt generated
-func FlushWithContext(
-	context string, into io.Writer, from io.ReadCloser,
-) {
-	defer from.Close()
-
-	var buf bytes.Buffer
-	tmp := make([]byte, 1)
-
-	for {
-		n, err := from.Read(tmp)
-		if n > 0 {
-			c := tmp[0]
-			buf.WriteByte(c)
-
-			if c == '\n' || c == '\r' {
-				line := buf.Bytes()
-
-				if c == '\r' {
-					fmt.Fprintf(into, "\r%s %s", context, string(line[:len(line)-1]))
-				} else {
-					fmt.Fprintf(into, "\r%s %s", context, string(line))
-				}
-
-				buf.Reset()
-			}
-		}
-
-		if err == io.EOF {
-			if buf.Len() > 0 {
-				fmt.Fprintf(into, "%s %s", context, buf.String())
-			}
-			break
-		}
-
-		if err != nil {
-			break
-		}
-	}
-}
-
 // chatgpt generated
 func StreamLines(readClosers ...io.ReadCloser) io.ReadCloser {
 	pr, pw := io.Pipe()
@@ -161,14 +122,77 @@ func StreamLines(readClosers ...io.ReadCloser) io.ReadCloser {
 	return pr
 }
 
+// Calls fn for each line read from r without the trailing line break, stops
+// when fn returns false.
+func ReadLines(r io.Reader, fn func(line string) bool) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			if !fn(strings.TrimRight(line, "\r\n")) {
+				return nil
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
 func GetVarDir(pid int) string {
+	return filepath.Join(GetRuntimeDir(), "ella", strconv.Itoa(pid))
+}
+
+func GetRuntimeDir() string {
 	if uid := syscall.Getuid(); uid == 0 {
-		return fmt.Sprintf("/var/run/ella/%d", pid)
+		return "/var/run"
 	} else {
-		return fmt.Sprintf(
-			"/var/run/user/%d/ella/%d", uid, pid,
-		)
+		return fmt.Sprintf("/var/run/user/%d", uid)
+	}
+}
+
+func GetStateDir() string {
+	if syscall.Getuid() == 0 {
+		return "/var/lib"
+	}
+
+	return getXdgDir("XDG_STATE_HOME", ".local/state")
+}
+
+func GetCacheDir() string {
+	if syscall.Getuid() == 0 {
+		return "/var/cache"
 	}
+
+	return getXdgDir("XDG_CACHE_HOME", ".cache")
+}
+
+func GetLogsDir() string {
+	if syscall.Getuid() == 0 {
+		return "/var/log"
+	}
+
+	return filepath.Join(GetStateDir(), "log")
+}
+
+// Relative values are invalid according to the base directory spec.
+func getXdgDir(env, fallback string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		if u, err := user.Current(); err == nil {
+			home = u.HomeDir
+		}
+	}
+
+	return filepath.Join(home, fallback)
 }
 
 func WaitAny(
@@ -4,15 +4,20 @@ _ella_module() {
 	cur="${COMP_WORDS[COMP_CWORD]}"
 	prev="${COMP_WORDS[COMP_CWORD - 1]}"
 
-	cmds="run logs start stop restart reload list"
+	cmds="run logs status failures history show start stop restart reload scale list"
 	global_opts="-h -v"
 
 	logs_opts="-h -a -c"
+	status_opts="-h -a -c"
+	failures_opts="-h -a -c"
+	history_opts="-h -a -c"
+	show_opts="-h -a -c -resolved"
 	run_opts="-h -a -c -l"
 	start_opts="-h -a -c"
 	stop_opts="-h -a -c"
-	restart_opts="-h -a -c"
+	restart_opts="-h -a -c -rolling -max-unavailable -ready-timeout -min-ready"
 	reload_opts="-h -a -c"
+	scale_opts="-h -c"
 	list_opts="-h"
 
 	if [[ $COMP_CWORD -eq 1 ]]; then
@@ -23,7 +28,7 @@ _ella_module() {
 	local subcmd=""
 	for word in "${COMP_WORDS[@]}"; do
 		case "$word" in
-		run | logs | start | stop | restart | reload | list)
+		run | logs | status | failures | history | show | start | stop | restart | reload | scale | list)
 			subcmd=$word
 			break
 			;;
@@ -34,10 +39,15 @@ _ella_module() {
 		case "$subcmd" in
 		run) COMPREPLY=($(compgen -W "${run_opts}" -- "$cur")) ;;
 		logs) COMPREPLY=($(compgen -W "${logs_opts}" -- "$cur")) ;;
+		status) COMPREPLY=($(compgen -W "${status_opts}" -- "$cur")) ;;
+		failures) COMPREPLY=($(compgen -W "${failures_opts}" -- "$cur")) ;;
+		history) COMPREPLY=($(compgen -W "${history_opts}" -- "$cur")) ;;
+		show) COMPREPLY=($(compgen -W "${show_opts}" -- "$cur")) ;;
 		start) COMPREPLY=($(compgen -W "${start_opts}" -- "$cur")) ;;
 		stop) COMPREPLY=($(compgen -W "${stop_opts}" -- "$cur")) ;;
 		restart) COMPREPLY=($(compgen -W "${restart_opts}" -- "$cur")) ;;
 		reload) COMPREPLY=($(compgen -W "${reload_opts}" -- "$cur")) ;;
+		scale) COMPREPLY=($(compgen -W "${scale_opts}" -- "$cur")) ;;
 		list) COMPREPLY=($(compgen -W "${list_opts}" -- "$cur")) ;;
 		*) COMPREPLY=($(compgen -W "${global_opts}" -- "$cur")) ;;
 		esac
@@ -0,0 +1,78 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var envKeyPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Parses variables in dotenv format, in the order they're defined:
+//
+//	# comment
+//	KEY=value # comment
+//	export KEY="escaped\nvalue"
+//	KEY='literal value'
+func ParseDotenv(r io.Reader) ([][2]string, error) {
+	vars := make([][2]string, 0)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+		key, val, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !envKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("line %d: invalid variable: %s", n, line)
+		}
+
+		val, err := parseDotenvValue(strings.TrimSpace(val))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		vars = append(vars, [2]string{key, val})
+	}
+
+	return vars, scanner.Err()
+}
+
+func parseDotenvValue(val string) (string, error) {
+	if val == "" {
+		return "", nil
+	}
+
+	switch quote := val[0]; quote {
+	case '\'', '"':
+		end := strings.LastIndexByte(val, quote)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated quote: %s", val)
+		}
+		rest := strings.TrimSpace(val[end+1:])
+		if rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected characters after quote: %s", rest)
+		}
+
+		val = val[1:end]
+		if quote == '\'' {
+			return val, nil
+		}
+		return strings.NewReplacer(
+			`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`,
+		).Replace(val), nil
+	default:
+		// Comments have to be separated from unquoted values.
+		if i := strings.Index(val, " #"); i != -1 {
+			val = strings.TrimSpace(val[:i])
+		}
+		return val, nil
+	}
+}
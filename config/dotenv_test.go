@@ -0,0 +1,44 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseDotenv(t *testing.T) {
+	vars, err := ParseDotenv(strings.NewReader(`
+# comment
+A=1
+export B = two words # comment
+C="line\nbreak \"quoted\"" # comment
+D='$literal\n'
+E=
+F=a#b
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][2]string{
+		{"A", "1"},
+		{"B", "two words"},
+		{"C", "line\nbreak \"quoted\""},
+		{"D", `$literal\n`},
+		{"E", ""},
+		{"F", "a#b"},
+	}
+	if !slices.Equal(vars, expected) {
+		t.Errorf("unexpected variables: expected: %q received: %q", expected, vars)
+	}
+
+	for _, invalid := range []string{"NOVALUE", "1A=b", `A="open`, `A="a" b`} {
+		_, err := ParseDotenv(strings.NewReader(invalid))
+		if err == nil {
+			t.Errorf("expected an error for %s", invalid)
+		}
+	}
+}
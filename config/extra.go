@@ -7,7 +7,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
+	"maps"
+	"math"
 	"os"
 	"os/user"
 	"path/filepath"
@@ -15,6 +16,9 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
+
+	"github.com/thekhanj/ella/common"
 )
 
 func GetPidFile(pidFile *string) string {
@@ -38,93 +42,627 @@ func ReadConfig(path string, cfg *Config) error {
 	return cfg.UnmarshalJSON(b)
 }
 
+// Reads the config along with the services of the included files.
 func ReadParsedConfig(path string, cfg *Config) error {
-	var raw Config
-	err := ReadConfig(path, &raw)
+	root, _, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+
+	templates := make(map[string]map[string]any)
+	raws, err := readServices(path, []string{}, templates)
 	if err != nil {
 		return err
 	}
+	services := make([]Service, 0)
+	for _, raw := range raws {
+		s, err := raw.resolve(templates)
+		if err != nil {
+			return fmt.Errorf("service %v: %w", raw.fields["name"], err)
+		}
+		services = append(services, s)
+	}
+
+	cfg.PidFile = root.PidFile
+	cfg.Include = root.Include
+	cfg.Templates = templates
+	cfg.LogSinks = root.LogSinks
+	cfg.Services = services
 
-	return raw.IncludeAll(cfg)
+	return cfg.checkDuplicateServices()
 }
 
-func (this *Config) IncludeAll(cfg *Config) error {
-	return this.includeAll(cfg, []string{})
+func (this *Config) checkDuplicateServices() error {
+	cfgs := make(map[string]bool)
+	for _, s := range this.Services {
+		if cfgs[s.Name] == true {
+			return fmt.Errorf("duplicate service name: %s", s.Name)
+		}
+		cfgs[s.Name] = true
+	}
+
+	return nil
 }
 
-func (this *Config) includeAll(cfg *Config, included []string) error {
-	cfg.PidFile = this.PidFile
-	services := make([]Service, 0)
+// Checks the instance name of an instance e.g. eu of worker@eu, it ends up
+// in paths such as the cgroup and the notify socket of the instance. Names
+// without an instance are fine.
+func ValidateInstanceName(name string) error {
+	_, instance, ok := strings.Cut(name, "@")
+	if !ok {
+		return nil
+	}
+
+	if instance == "" || strings.Contains(instance, "/") ||
+		strings.Contains(instance, "..") || strings.ContainsRune(instance, 0) {
+		return fmt.Errorf("invalid instance name: %s", name)
+	}
 
-	for _, glob := range this.Include {
-		cfgs, err := this.globReadConfig(included, glob)
+	return nil
+}
+
+// Returns the service named name, instances e.g. worker@eu are returned as
+// their template service e.g. worker@ named after the instance. Instances
+// with invalid names aren't found.
+func (this *Config) GetService(name string) (Service, bool) {
+	template := ""
+	if prefix, instance, ok := strings.Cut(name, "@"); ok && instance != "" {
+		if ValidateInstanceName(name) != nil {
+			return Service{}, false
+		}
+		template = prefix + "@"
+	}
+
+	for _, s := range this.Services {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	for _, s := range this.Services {
+		if template != "" && s.Name == template {
+			s.Name = name
+			return s, true
+		}
+	}
+
+	return Service{}, false
+}
+
+// A service which hasn't been decoded yet, so the templates and defaults of
+// the includes only fill in what the service hasn't defined.
+type rawService struct {
+	fields map[string]any
+	// Defaults of the includes bringing in the service, innermost first.
+	defaults []map[string]any
+}
+
+// Applies the templates the service extends, then the defaults, and decodes
+// the result which validates it.
+func (this *rawService) resolve(templates map[string]map[string]any) (Service, error) {
+	fields := cloneJSON(this.fields).(map[string]any)
+	err := extend(fields, templates, []string{})
+	if err != nil {
+		return Service{}, err
+	}
+	for _, defaults := range this.defaults {
+		mergeDefaults(fields, defaults)
+	}
+
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return Service{}, err
+	}
+	var s Service
+	err = s.UnmarshalJSON(b)
+	return s, err
+}
+
+// Merges the templates fields extends into fields, chain is the templates
+// being extended.
+func extend(
+	fields map[string]any, templates map[string]map[string]any, chain []string,
+) error {
+	var names []string
+	switch extends := fields["extends"].(type) {
+	case nil:
+		return nil
+	case string:
+		names = []string{extends}
+	case []any:
+		for _, name := range extends {
+			if str, ok := name.(string); ok {
+				names = append(names, str)
+			} else {
+				return fmt.Errorf("invalid template name: %v", name)
+			}
+		}
+	default:
+		return fmt.Errorf("invalid extends: %v", extends)
+	}
+
+	// Later templates take precedence, so they're merged first.
+	for _, name := range slices.Backward(names) {
+		if slices.Contains(chain, name) {
+			return fmt.Errorf(
+				"circular extension: %s -> %s", strings.Join(chain, " -> "), name,
+			)
+		}
+		template, ok := templates[name]
+		if !ok {
+			return fmt.Errorf("template not found: %s", name)
+		}
+
+		resolved := cloneJSON(template).(map[string]any)
+		err := extend(resolved, templates, append(slices.Clip(chain), name))
 		if err != nil {
 			return err
 		}
+		delete(resolved, "extends")
+		mergeDefaults(fields, resolved)
+	}
+
+	return nil
+}
+
+// Returns the services of the file and its included files, the templates
+// of the files are added to templates. included is the chain of the files
+// including this one.
+func readServices(
+	path string, included []string, templates map[string]map[string]any,
+) ([]*rawService, error) {
+	canonical, err := canonicalPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(included, canonical) {
+		return nil, fmt.Errorf(
+			"circular inclusion: %s -> %s",
+			strings.Join(included, " -> "), canonical,
+		)
+	}
+	included = append(slices.Clip(included), canonical)
+
+	cfg, rawServices, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for name, template := range cfg.Templates {
+		if _, ok := templates[name]; ok {
+			return nil, fmt.Errorf("%s: duplicate template name: %s", path, name)
+		}
+		resolveEnvFiles(template, filepath.Dir(path))
+		templates[name] = template
+	}
+
+	services := make([]*rawService, 0)
+	for _, include := range cfg.Include {
+		pattern, defaults, err := parseInclude(include)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if defaults != nil {
+			resolveEnvFiles(defaults, filepath.Dir(path))
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
 
-		for _, cfg := range cfgs {
-			services = append(services, cfg.Services...)
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for _, file := range files {
+			subs, err := readServices(file, included, templates)
+			if err != nil {
+				return nil, err
+			}
+			for _, sub := range subs {
+				if defaults != nil {
+					sub.defaults = append(sub.defaults, defaults)
+				}
+			}
+			services = append(services, subs...)
 		}
 	}
 
-	services = append(services, this.Services...)
-	cfg.Services = services
+	for _, fields := range rawServices {
+		resolveEnvFiles(fields, filepath.Dir(path))
+		services = append(services, &rawService{fields, nil})
+	}
+	return services, nil
+}
 
-	err := this.checkDuplicateServices(cfg)
+// Environment files of a service, template or include defaults are relative
+// to the directory of the file declaring them, dir.
+func resolveEnvFiles(fields map[string]any, dir string) {
+	process, ok := fields["process"].(map[string]any)
+	if !ok {
+		return
+	}
+	files, ok := process["environmentFiles"].([]any)
+	if !ok {
+		return
+	}
+
+	for i, file := range files {
+		// Invalid values are reported once the service gets decoded.
+		path, ok := file.(string)
+		if !ok {
+			continue
+		}
+		optional := strings.HasPrefix(path, "-")
+		path = strings.TrimPrefix(path, "-")
+		if filepath.IsAbs(path) {
+			continue
+		}
+
+		path = filepath.Join(dir, path)
+		if optional {
+			path = "-" + path
+		}
+		files[i] = path
+	}
+}
+
+// Returns the config without its services, which are validated once their
+// templates are resolved, and the undecoded services.
+func readConfigFile(path string) (Config, []map[string]any, error) {
+	b, err := os.ReadFile(path)
 	if err != nil {
-		return err
+		return Config{}, nil, err
+	}
+	var raw map[string]any
+	err = json.Unmarshal(b, &raw)
+	if err != nil {
+		return Config{}, nil, fmt.Errorf("%s: %w", path, err)
 	}
 
-	return nil
+	services := make([]map[string]any, 0)
+	if list, ok := raw["services"].([]any); ok {
+		for _, s := range list {
+			m, ok := s.(map[string]any)
+			if !ok {
+				return Config{}, nil, fmt.Errorf("%s: invalid service: %v", path, s)
+			}
+			services = append(services, m)
+		}
+		raw["services"] = []any{}
+	}
+
+	b, err = json.Marshal(raw)
+	if err != nil {
+		return Config{}, nil, err
+	}
+	var cfg Config
+	err = cfg.UnmarshalJSON(b)
+	if err != nil {
+		return Config{}, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return cfg, services, nil
 }
 
-func (this *Config) checkDuplicateServices(cfg *Config) error {
-	cfgs := make(map[string]bool)
-	for _, s := range cfg.Services {
-		if cfgs[s.Name] == true {
-			return fmt.Errorf("duplicate service name: %s", s.Name)
+func parseInclude(include any) (string, map[string]any, error) {
+	if pattern, ok := include.(string); ok {
+		return pattern, nil, nil
+	} else if m, ok := include.(map[string]any); ok {
+		b, err := json.Marshal(m)
+		if err != nil {
+			return "", nil, err
 		}
-		cfgs[s.Name] = true
+		var i IncludeWithDefaults
+		err = i.UnmarshalJSON(b)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return i.Path, i.Defaults, nil
+	} else {
+		return "", nil, fmt.Errorf("invalid include: %v", include)
 	}
+}
 
-	return nil
+// The same file is reachable through different paths, e.g. symlinks.
+func canonicalPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.EvalSymlinks(abs)
+}
+
+// Merges objects of defaults into the ones of dst, other values are only
+// set when dst doesn't have them.
+func mergeDefaults(dst, defaults map[string]any) {
+	for key, def := range defaults {
+		val, ok := dst[key]
+		if !ok {
+			dst[key] = cloneJSON(def)
+			continue
+		}
+
+		valMap, ok := val.(map[string]any)
+		defMap, defOk := def.(map[string]any)
+		if ok && defOk {
+			mergeDefaults(valMap, defMap)
+		}
+	}
+}
+
+func cloneJSON(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		ret := make(map[string]any, len(v))
+		for key, val := range v {
+			ret[key] = cloneJSON(val)
+		}
+		return ret
+	case []any:
+		ret := make([]any, 0, len(v))
+		for _, val := range v {
+			ret = append(ret, cloneJSON(val))
+		}
+		return ret
+	default:
+		return v
+	}
+}
+
+func (this *Config) GetLogSinks() ([]LogSink, error) {
+	sinks := make([]LogSink, 0)
+	for _, sink := range this.LogSinks {
+		parsed, err := parseLogSink(sink)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, parsed)
+	}
+
+	return sinks, nil
+}
+
+// Returns the log sinks of the service, falling back to the global ones when
+// the service doesn't define its own.
+func (this *Service) GetLogSinks(global []LogSink) ([]LogSink, error) {
+	if this.LogSinks == nil {
+		return global, nil
+	}
+
+	sinks := make([]LogSink, 0)
+	for _, sink := range this.LogSinks {
+		parsed, err := parseLogSink(sink)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, parsed)
+	}
+
+	return sinks, nil
 }
 
-func (this *Config) globReadConfig(
-	included []string, pattern string,
-) ([]*Config, error) {
-	files, err := filepath.Glob(pattern)
+func parseLogSink(sink any) (LogSink, error) {
+	m, ok := sink.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid log sink: %v", sink)
+	}
+
+	b, err := json.Marshal(m)
 	if err != nil {
 		return nil, err
 	}
 
-	cfgs := make([]*Config, 0)
-	for _, file := range files {
-		if slices.Contains(included, file) {
-			return nil, fmt.Errorf(
-				"circular inclusion: %s -> %s",
-				strings.Join(included, " -> "), file,
-			)
+	switch m["type"] {
+	case "syslog":
+		var s SyslogLogSink
+		err = s.UnmarshalJSON(b)
+		if err != nil {
+			return nil, err
+		}
+		return &s, nil
+	case "journald":
+		var s JournaldLogSink
+		err = s.UnmarshalJSON(b)
+		if err != nil {
+			return nil, err
+		}
+		return &s, nil
+	default:
+		return nil, fmt.Errorf("invalid log sink type: %s", m["type"])
+	}
+}
+
+// Whether the service is a template, e.g. worker@, its instances e.g.
+// worker@eu are created on demand.
+func (this *Service) IsTemplate() bool {
+	return strings.HasSuffix(this.Name, "@")
+}
+
+// Whether the service has replicas, which are services of their own.
+func (this *Service) IsReplicated() bool {
+	return this.Replicas != nil
+}
+
+// Returns the replica of the service numbered i, counting from 1.
+func (this *Service) GetReplica(i int) Service {
+	replica := *this
+	replica.Name = fmt.Sprintf("%s.%d", this.Name, i)
+	if this.Port != nil {
+		port := *this.Port + i - 1
+		replica.Port = &port
+	}
+
+	return replica
+}
+
+// Variables defined by ella for interpolation, replica is the number of the
+// replica returned by GetReplica, 0 when the service isn't a replica.
+func (this *Service) GetVars(replica int) map[string]string {
+	name := this.Name
+	vars := map[string]string{
+		"ELLA_SERVICE":     this.Name,
+		"ELLA_RUNTIME_DIR": common.GetRuntimeDir(),
+	}
+	if replica > 0 {
+		name = strings.TrimSuffix(name, fmt.Sprintf(".%d", replica))
+		vars["ELLA_REPLICA"] = strconv.Itoa(replica)
+	}
+	_, vars["ELLA_INSTANCE"], _ = strings.Cut(name, "@")
+	if this.Port != nil {
+		vars["PORT"] = strconv.Itoa(*this.Port)
+	}
+
+	return vars
+}
+
+// Environment variables defined by ella for the process, taking precedence
+// over the environments of the process.
+func (this *Service) GetBuiltinEnv(replica int) []string {
+	vars := this.GetVars(replica)
+	env := make([]string, 0)
+	for _, key := range []string{"ELLA_REPLICA", "PORT"} {
+		if val, ok := vars[key]; ok {
+			env = append(env, fmt.Sprintf("%s=%s", key, val))
+		}
+	}
+
+	return env
+}
+
+func (this *Service) GetRestart() (RestartStrategy, error) {
+	m, ok := this.Restart.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid restart strategy: %v", this.Restart)
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	switch m["strategy"] {
+	case "always":
+		var r AlwaysRestart
+		err = r.UnmarshalJSON(b)
+		if err != nil {
+			return nil, err
+		}
+		return &r, nil
+	case "on-failure":
+		var r OnFailureRestart
+		err = r.UnmarshalJSON(b)
+		if err != nil {
+			return nil, err
 		}
+		return &r, nil
+	case "never":
+		var r NeverRestart
+		err = r.UnmarshalJSON(b)
+		if err != nil {
+			return nil, err
+		}
+		return &r, nil
+	default:
+		return nil, fmt.Errorf("invalid restart strategy: %s", m["strategy"])
+	}
+}
+
+// Exit codes and signal names of an exit status list.
+type ExitStatuses struct {
+	Codes   []int
+	Signals []string
+}
 
-		var cfg Config
-		err = ReadConfig(file, &cfg)
+func (this *Service) GetSuccessExitStatus() (ExitStatuses, error) {
+	return parseExitStatuses(this.SuccessExitStatus)
+}
+
+func (this *Service) GetRestartPreventExitStatus() (ExitStatuses, error) {
+	return parseExitStatuses(this.RestartPreventExitStatus)
+}
+
+func (this *Service) GetRestartForceExitStatus() (ExitStatuses, error) {
+	return parseExitStatuses(this.RestartForceExitStatus)
+}
+
+func parseExitStatuses[T any](statuses []T) (ExitStatuses, error) {
+	ret := ExitStatuses{
+		Codes:   make([]int, 0),
+		Signals: make([]string, 0),
+	}
+
+	for _, status := range statuses {
+		switch v := any(status).(type) {
+		case float64:
+			ret.Codes = append(ret.Codes, int(v))
+		case int:
+			ret.Codes = append(ret.Codes, v)
+		case string:
+			ret.Signals = append(ret.Signals, v)
+		default:
+			return ret, fmt.Errorf("invalid exit status: %v", status)
+		}
+	}
+
+	return ret, nil
+}
+
+func (this *Socket) GetName(service string) string {
+	if this.Name == nil {
+		return service
+	}
+
+	return *this.Name
+}
+
+func (this *Socket) GetMode() (os.FileMode, error) {
+	mode, err := strconv.ParseUint(this.Mode, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+
+	return os.FileMode(mode), nil
+}
+
+// Returns nil when the socket file is owned by the user of the main process.
+func (this *Socket) GetUid() (*uint32, error) {
+	if this.User == nil {
+		return nil, nil
+	}
+
+	var uid uint32
+	if name, ok := this.User.(string); ok {
+		user, err := user.Lookup(name)
 		if err != nil {
 			return nil, err
 		}
 
-		included = append(included, file)
-		var subCfg Config
-		err := cfg.includeAll(&subCfg, included)
-		included = included[:len(included)-1]
+		id, err := strconv.Atoi(user.Uid)
 		if err != nil {
 			return nil, err
 		}
+		uid = uint32(id)
+	} else if id, ok := this.User.(float64); ok {
+		uid = uint32(id)
+	} else {
+		return nil, fmt.Errorf("invalid user: %v", this.User)
+	}
+
+	return &uid, nil
+}
 
-		cfgs = append(cfgs, &subCfg)
+// Returns nil when the socket file has the group of the main process.
+func (this *Socket) GetGid() (*uint32, error) {
+	if this.Group == nil {
+		return nil, nil
 	}
 
-	return cfgs, nil
+	gid, err := parseGroup(this.Group)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gid, nil
 }
 
 func (this *Proc) GetStop() (StopProcAction, error) {
@@ -145,7 +683,7 @@ func (this *Proc) GetStop() (StopProcAction, error) {
 			}
 			return &c, nil
 		case "exec":
-			return nil, errors.New("not implemented")
+			return parseProcActionExec(m)
 		default:
 			return nil, fmt.Errorf("invalid action type: %s", m["type"])
 		}
@@ -161,7 +699,7 @@ func (this *Proc) GetReload() (ReloadProcAction, error) {
 	} else if m, ok := reload.(map[string]any); ok {
 		switch m["type"] {
 		case "exec":
-			return nil, errors.New("not implemented")
+			return parseProcActionExec(m)
 		default:
 			return nil, fmt.Errorf("invalid action type: %s", m["type"])
 		}
@@ -170,6 +708,20 @@ func (this *Proc) GetReload() (ReloadProcAction, error) {
 	}
 }
 
+func parseProcActionExec(m map[string]any) (*ProcActionExec, error) {
+	var c ProcActionExec
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	err = c.UnmarshalJSON(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
 func (this *Proc) GetWatchdog() (ProcWatchdog, error) {
 	if this.Watchdog == nil {
 		return &SimpleWatchdog{
@@ -211,18 +763,40 @@ func (this *Proc) GetUid() (uint32, error) {
 		}
 
 		return uint32(uid), nil
-	} else if uid, ok := u.(int); ok {
+	} else if uid, ok := u.(float64); ok {
 		return uint32(uid), nil
 	} else {
 		return 0, fmt.Errorf("invalid user: %v", u)
 	}
 }
 
+// Returns the user the process runs as from the user database, nil when it
+// runs as the user of the main process or the uid is not in the database.
+func (this *Proc) GetUser() (*user.User, error) {
+	u := this.User
+	if uStr, ok := u.(string); ok {
+		if uStr == "!inherit" {
+			return nil, nil
+		}
+
+		return user.Lookup(uStr)
+	} else if uid, ok := u.(float64); ok {
+		ret, err := user.LookupId(strconv.Itoa(int(uid)))
+		if _, ok := err.(user.UnknownUserIdError); ok {
+			return nil, nil
+		}
+
+		return ret, err
+	} else {
+		return nil, fmt.Errorf("invalid user: %v", u)
+	}
+}
+
 func (this *Proc) GetGid() (uint32, error) {
 	g := this.Group
 	if gStr, ok := g.(string); ok {
 		if gStr == "!inherit" {
-			return uint32(syscall.Getgid()), nil
+			return this.getUserGid()
 		}
 
 		group, err := user.LookupGroup(gStr)
@@ -236,51 +810,496 @@ func (this *Proc) GetGid() (uint32, error) {
 		}
 
 		return uint32(gid), nil
-	} else if uid, ok := g.(int); ok {
-		return uint32(uid), nil
+	} else if gid, ok := g.(float64); ok {
+		return uint32(gid), nil
 	} else {
 		return 0, fmt.Errorf("invalid group: %v", g)
 	}
 }
 
-func (this *Proc) GetStdin() (io.ReadCloser, error) {
-	if this.Stdin == nil {
+// The primary group of the user, when the process runs as another user.
+func (this *Proc) getUserGid() (uint32, error) {
+	u, err := this.GetUser()
+	if err != nil {
+		return 0, err
+	}
+	if u == nil {
+		return uint32(syscall.Getgid()), nil
+	}
+
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint32(gid), nil
+}
+
+// Returns nil when the supplementary groups of the main process are kept.
+func (this *Proc) GetSupplementaryGroups() ([]uint32, error) {
+	if this.SupplementaryGroups != nil {
+		gids := make([]uint32, 0)
+		for _, g := range this.SupplementaryGroups {
+			gid, err := parseGroup(g)
+			if err != nil {
+				return nil, err
+			}
+			gids = append(gids, gid)
+		}
+
+		return gids, nil
+	}
+
+	u, err := this.GetUser()
+	if err != nil || u == nil {
+		return nil, err
+	}
+	ids, err := u.GroupIds()
+	if err != nil {
+		return nil, err
+	}
+
+	gids := make([]uint32, 0)
+	for _, id := range ids {
+		gid, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, err
+		}
+		gids = append(gids, uint32(gid))
+	}
+
+	return gids, nil
+}
+
+func parseGroup(g any) (uint32, error) {
+	if name, ok := g.(string); ok {
+		group, err := user.LookupGroup(name)
+		if err != nil {
+			return 0, err
+		}
+
+		gid, err := strconv.Atoi(group.Gid)
+		if err != nil {
+			return 0, err
+		}
+
+		return uint32(gid), nil
+	} else if gid, ok := g.(float64); ok {
+		return uint32(gid), nil
+	} else {
+		return 0, fmt.Errorf("invalid group: %v", g)
+	}
+}
+
+// Returns HOME, USER, LOGNAME and SHELL of the user the process runs as,
+// nil when it runs as the user of the main process.
+func (this *Proc) GetIdentityEnv() ([]string, error) {
+	u, err := this.GetUser()
+	if err != nil || u == nil {
+		return nil, err
+	}
+
+	return []string{
+		"HOME=" + u.HomeDir,
+		"USER=" + u.Username,
+		"LOGNAME=" + u.Username,
+		"SHELL=" + lookupShell(u.Username),
+	}, nil
+}
+
+// os/user doesn't provide login shells, users not listed in /etc/passwd,
+// e.g. the ones of directory services, get /bin/sh.
+func lookupShell(username string) string {
+	b, err := os.ReadFile("/etc/passwd")
+	if err != nil {
+		return "/bin/sh"
+	}
+
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) == 7 && fields[0] == username && fields[6] != "" {
+			return fields[6]
+		}
+	}
+
+	return "/bin/sh"
+}
+
+// Returns nil when the umask of the main process is kept.
+func (this *Proc) GetUmask() (*int, error) {
+	if this.Umask == nil {
 		return nil, nil
 	}
 
-	if path, ok := this.Stdin.(string); ok {
-		file, err := os.Open(path)
+	umask, err := strconv.ParseInt(*this.Umask, 8, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := int(umask)
+	return &ret, nil
+}
+
+func (this *Proc) GetDirectoryMode() (os.FileMode, error) {
+	if this.DirectoryMode == "" {
+		return 0755, nil
+	}
+
+	mode, err := strconv.ParseUint(this.DirectoryMode, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+
+	return os.FileMode(mode), nil
+}
+
+// Limit of a resource of a process, LimitInfinity means no limit.
+type ResourceLimit struct {
+	Name string
+	Soft uint64
+	Hard uint64
+}
+
+const LimitInfinity uint64 = math.MaxUint64
+
+func (this *Proc) GetLimits() ([]ResourceLimit, error) {
+	limits := make([]ResourceLimit, 0)
+	if this.Limits == nil {
+		return limits, nil
+	}
+
+	items := []struct {
+		name  string
+		value any
+	}{
+		{"nofile", this.Limits.Nofile},
+		{"nproc", this.Limits.Nproc},
+		{"core", this.Limits.Core},
+		{"memlock", this.Limits.Memlock},
+		{"stack", this.Limits.Stack},
+		{"as", this.Limits.As},
+	}
+	for _, item := range items {
+		if item.value == nil {
+			continue
+		}
+
+		soft, hard, err := parseLimit(item.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s limit: %w", item.name, err)
+		}
+		limits = append(limits, ResourceLimit{item.name, soft, hard})
+	}
+
+	return limits, nil
+}
+
+func parseLimit(limit any) (uint64, uint64, error) {
+	if n, ok := limit.(float64); ok {
+		return uint64(n), uint64(n), nil
+	}
+	str, ok := limit.(string)
+	if !ok {
+		return 0, 0, fmt.Errorf("%v", limit)
+	}
+
+	softStr, hardStr, found := strings.Cut(str, ":")
+	if !found {
+		hardStr = softStr
+	}
+	soft, err := parseLimitValue(softStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	hard, err := parseLimitValue(hardStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	if soft > hard {
+		return 0, 0, fmt.Errorf("soft limit is above the hard limit: %s", str)
+	}
+
+	return soft, hard, nil
+}
+
+func parseLimitValue(value string) (uint64, error) {
+	if value == "infinity" {
+		return LimitInfinity, nil
+	}
+
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// Returns the cpus of cpuAffinity, nil when it's not set.
+func (this *Proc) GetCpuAffinity() ([]int, error) {
+	if this.CpuAffinity == nil {
+		return nil, nil
+	}
+
+	cpus := make([]int, 0)
+	for _, part := range strings.Split(*this.CpuAffinity, ",") {
+		fromStr, toStr, found := strings.Cut(part, "-")
+		if !found {
+			toStr = fromStr
+		}
+		from, err := strconv.Atoi(fromStr)
+		if err != nil {
+			return nil, err
+		}
+		to, err := strconv.Atoi(toStr)
 		if err != nil {
 			return nil, err
 		}
-		return file, nil
+		if from > to {
+			return nil, fmt.Errorf("invalid cpu range: %s", part)
+		}
+
+		for cpu := from; cpu <= to; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+
+	return cpus, nil
+}
+
+// Returns the interpolated path of the stdin file, empty when there's none.
+func (this *Proc) GetStdinPath(vars Vars) (string, error) {
+	if this.Stdin == nil {
+		return "", nil
+	}
+
+	if path, ok := this.Stdin.(string); ok {
+		return Interpolate(path, vars)
 	} else {
-		return nil, fmt.Errorf("invalid stdin: %v", this.Stdin)
+		return "", fmt.Errorf("invalid stdin: %v", this.Stdin)
 	}
 }
 
-func (this *Proc) GetEnv() ([]string, error) {
-	env := this.Environments
+// Layers the identity of the user, environment files and the explicitly
+// defined variables on top of the base environment, in this order. Variables
+// keep the position they were first defined at. Explicitly defined values are
+// interpolated from vars and the layers below them.
+func (this *Proc) GetEnv(vars map[string]string) ([]string, error) {
+	env := newEnvList()
+	err := this.setBaseEnv(env)
+	if err != nil {
+		return nil, err
+	}
 
-	if inherit, ok := env.(string); ok && inherit == "!inherit" {
-		return os.Environ(), nil
-	} else if mp, ok := env.(map[string]any); ok {
-		envs := make([]string, 0)
-		for key, val := range mp {
-			parsed, err := this.parseEnvVal(key, val)
-			if err != nil {
-				return nil, err
-			}
-			envs = append(envs, fmt.Sprintf("%s=%s", key, parsed))
+	identity, err := this.GetIdentityEnv()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range identity {
+		key, val, _ := strings.Cut(e, "=")
+		env.set(key, val)
+	}
+
+	for _, path := range this.EnvironmentFiles {
+		vars, err := readEnvFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range vars {
+			env.set(v[0], v[1])
+		}
+	}
+
+	mp, err := this.getEnvironments()
+	if err != nil {
+		return nil, err
+	}
+	lower := NewVars(vars, env.list())
+	for _, key := range slices.Sorted(maps.Keys(mp)) {
+		// Secrets are read when the process gets spawned, see GetSecretEnv.
+		if isSecretEnvVal(mp[key]) {
+			continue
+		}
+
+		parsed, err := this.parseEnvVal(key, mp[key], lower)
+		if err != nil {
+			return nil, err
+		}
+		env.set(key, parsed)
+	}
+
+	return env.list(), nil
+}
+
+func (this *Proc) getEnvironments() (map[string]any, error) {
+	switch env := this.Environments.(type) {
+	case nil:
+		return map[string]any{}, nil
+	case map[string]any:
+		return env, nil
+	case string:
+		if env == "!inherit" {
+			return map[string]any{}, nil
 		}
+	}
+
+	return nil, fmt.Errorf("invalid environments: %v", this.Environments)
+}
+
+// Environment variable read each time the process gets spawned, from either
+// a file or the output of a command.
+type SecretEnv struct {
+	Key  string
+	Path string
+	Exec string
+	// How long the output of the command is reused.
+	Ttl time.Duration
+}
 
-		return envs, nil
+// Returns the secrets among the explicitly defined variables, ordered by
+// their names. Paths are interpolated from vars.
+func (this *Proc) GetSecretEnv(vars Vars) ([]SecretEnv, error) {
+	mp, err := this.getEnvironments()
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make([]SecretEnv, 0)
+	for _, key := range slices.Sorted(maps.Keys(mp)) {
+		if !isSecretEnvVal(mp[key]) {
+			continue
+		}
+
+		secret, err := parseSecretEnv(key, mp[key].(map[string]any), vars)
+		if err != nil {
+			return nil, fmt.Errorf("environment variable %s: %w", key, err)
+		}
+		secrets = append(secrets, secret)
+	}
+
+	return secrets, nil
+}
+
+func isSecretEnvVal(val any) bool {
+	m, ok := val.(map[string]any)
+	return ok && (m["type"] == "file" || m["type"] == "command")
+}
+
+func parseSecretEnv(
+	key string, m map[string]any, vars Vars,
+) (SecretEnv, error) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return SecretEnv{}, err
+	}
+
+	if m["type"] == "file" {
+		var file FileEnvValue
+		err = file.UnmarshalJSON(b)
+		if err != nil {
+			return SecretEnv{}, err
+		}
+		path, err := Interpolate(file.Path, vars)
+		if err != nil {
+			return SecretEnv{}, err
+		}
+
+		return SecretEnv{Key: key, Path: path}, nil
+	}
+
+	var command CommandEnvValue
+	err = command.UnmarshalJSON(b)
+	if err != nil {
+		return SecretEnv{}, err
+	}
+	ttl, err := time.ParseDuration(string(command.Ttl))
+	if err != nil {
+		return SecretEnv{}, err
+	}
+
+	return SecretEnv{Key: key, Exec: string(command.Exec), Ttl: ttl}, nil
+}
+
+func (this *Proc) setBaseEnv(env *envList) error {
+	base := this.EnvironmentBase
+	// Kept for compatibility, environments used to be either inherited or
+	// explicitly defined.
+	if inherit, ok := this.Environments.(string); ok && inherit == "!inherit" {
+		base = "inherit"
+	}
+
+	if base == nil || base == "clean" {
+		return nil
+	} else if base == "inherit" {
+		for _, e := range os.Environ() {
+			key, val, _ := strings.Cut(e, "=")
+			env.set(key, val)
+		}
+		return nil
+	} else if keys, ok := base.([]any); ok {
+		for _, key := range keys {
+			k, ok := key.(string)
+			if !ok {
+				return fmt.Errorf("invalid inherited environment variable: %v", key)
+			}
+			if val, found := os.LookupEnv(k); found {
+				env.set(k, val)
+			}
+		}
+		return nil
 	} else {
-		return nil, fmt.Errorf("invalid environments: %v", env)
+		return fmt.Errorf("invalid environment base: %v", base)
 	}
 }
 
-func (this *Proc) parseEnvVal(key string, val any) (string, error) {
+func readEnvFile(path string) ([][2]string, error) {
+	optional := strings.HasPrefix(path, "-")
+	path = strings.TrimPrefix(path, "-")
+
+	f, err := os.Open(path)
+	if optional && errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	vars, err := ParseDotenv(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return vars, nil
+}
+
+// Environment variables in the order they were first set.
+type envList struct {
+	keys []string
+	vals map[string]string
+}
+
+func newEnvList() *envList {
+	return &envList{
+		keys: make([]string, 0),
+		vals: make(map[string]string),
+	}
+}
+
+func (this *envList) set(key, val string) {
+	if _, ok := this.vals[key]; !ok {
+		this.keys = append(this.keys, key)
+	}
+	this.vals[key] = val
+}
+
+func (this *envList) list() []string {
+	envs := make([]string, 0, len(this.keys))
+	for _, key := range this.keys {
+		envs = append(envs, fmt.Sprintf("%s=%s", key, this.vals[key]))
+	}
+
+	return envs
+}
+
+func (this *Proc) parseEnvVal(
+	key string, val any, vars Vars,
+) (string, error) {
 	if str, ok := val.(string); ok {
 		if str == "!inherit" {
 			v, found := os.LookupEnv(key)
@@ -291,7 +1310,11 @@ func (this *Proc) parseEnvVal(key string, val any) (string, error) {
 			return v, nil
 		}
 
-		return str, nil
+		interpolated, err := Interpolate(str, vars)
+		if err != nil {
+			return "", fmt.Errorf("environment variable %s: %w", key, err)
+		}
+		return interpolated, nil
 	} else if literalObj, ok := val.(map[string]any); ok {
 		var literal LiteralEnvValue
 		b, err := json.Marshal(literalObj)
@@ -353,3 +1376,50 @@ func (this *ProcActionSignalCode) GetSignal() syscall.Signal {
 		panic(fmt.Sprintf("not implemented signal: %s", string(*this)))
 	}
 }
+
+func (this SyslogLogSinkFacility) GetCode() int {
+	switch this {
+	case SyslogLogSinkFacilityKern:
+		return 0
+	case SyslogLogSinkFacilityUser:
+		return 1
+	case SyslogLogSinkFacilityMail:
+		return 2
+	case SyslogLogSinkFacilityDaemon:
+		return 3
+	case SyslogLogSinkFacilityAuth:
+		return 4
+	case SyslogLogSinkFacilitySyslog:
+		return 5
+	case SyslogLogSinkFacilityLpr:
+		return 6
+	case SyslogLogSinkFacilityNews:
+		return 7
+	case SyslogLogSinkFacilityUucp:
+		return 8
+	case SyslogLogSinkFacilityCron:
+		return 9
+	case SyslogLogSinkFacilityAuthpriv:
+		return 10
+	case SyslogLogSinkFacilityFtp:
+		return 11
+	case SyslogLogSinkFacilityLocal0:
+		return 16
+	case SyslogLogSinkFacilityLocal1:
+		return 17
+	case SyslogLogSinkFacilityLocal2:
+		return 18
+	case SyslogLogSinkFacilityLocal3:
+		return 19
+	case SyslogLogSinkFacilityLocal4:
+		return 20
+	case SyslogLogSinkFacilityLocal5:
+		return 21
+	case SyslogLogSinkFacilityLocal6:
+		return 22
+	case SyslogLogSinkFacilityLocal7:
+		return 23
+	default:
+		panic(fmt.Sprintf("not implemented facility: %s", string(this)))
+	}
+}
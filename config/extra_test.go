@@ -0,0 +1,390 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestProcGetEnv(t *testing.T) {
+	t.Setenv("ELLA_TEST_KEPT", "kept")
+	t.Setenv("ELLA_TEST_DROPPED", "dropped")
+
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.env")
+	second := filepath.Join(dir, "second.env")
+	os.WriteFile(first, []byte("FILE=first\nELLA_TEST_KEPT=file\n"), 0644)
+	os.WriteFile(second, []byte("FILE=second\nMAP=file\n"), 0644)
+
+	proc := Proc{
+		User:            "!inherit",
+		EnvironmentBase: []any{"ELLA_TEST_KEPT", "ELLA_TEST_MISSING"},
+		EnvironmentFiles: []string{
+			first, "-" + filepath.Join(dir, "missing.env"), second,
+		},
+		Environments: map[string]any{"MAP": "map", "B": "b", "A": "a"},
+	}
+	for range 10 {
+		env, err := proc.GetEnv(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []string{
+			"ELLA_TEST_KEPT=file", "FILE=second", "MAP=map", "A=a", "B=b",
+		}
+		if !slices.Equal(env, expected) {
+			t.Fatalf("unexpected environment: expected: %q received: %q", expected, env)
+		}
+	}
+
+	proc.EnvironmentFiles = []string{filepath.Join(dir, "missing.env")}
+	_, err := proc.GetEnv(nil)
+	if err == nil {
+		t.Error("expected an error for a missing environment file")
+	}
+
+	env, err := (&Proc{User: "!inherit"}).GetEnv(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(env) != 0 {
+		t.Errorf("expected a clean environment: %q", env)
+	}
+}
+
+func TestProcGetEnvInterpolation(t *testing.T) {
+	t.Setenv("ELLA_TEST_HOST", "localhost")
+
+	proc := Proc{
+		User:            "!inherit",
+		EnvironmentBase: []any{"ELLA_TEST_HOST"},
+		Environments: map[string]any{
+			"ADDR": "${ELLA_TEST_HOST}:${PORT:-8080}",
+			"NAME": "${ELLA_SERVICE}",
+			"RAW":  "$$HOME $HOME",
+		},
+	}
+	env, err := proc.GetEnv(map[string]string{"ELLA_SERVICE": "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"ELLA_TEST_HOST=localhost", "ADDR=localhost:8080", "NAME=web",
+		"RAW=$HOME $HOME",
+	}
+	if !slices.Equal(env, expected) {
+		t.Errorf("unexpected environment: expected: %q received: %q", expected, env)
+	}
+
+	// Explicitly defined variables can't refer to each other.
+	proc.Environments = map[string]any{"A": "a", "B": "${A}"}
+	_, err = proc.GetEnv(nil)
+	if err == nil {
+		t.Error("expected an error for an undefined variable")
+	}
+}
+
+func TestReadParsedConfig(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"ella.json": `{
+			"include": [
+				"conf.d/*.json",
+				{
+					"path": "shared/*.json",
+					"defaults": {
+						"process": {"user": "nobody", "environments": {"A": "a", "B": "b"}}
+					}
+				}
+			],
+			"services": [{"name": "main", "process": {"exec": "main"}, "restart": {"strategy": "never"}}]
+		}`,
+		"conf.d/first.json": `{
+			"services": [{"name": "first", "process": {"exec": "first"}, "restart": {"strategy": "never"}}]
+		}`,
+		"shared/second.json": `{
+			"include": [{"path": "nested/*.json", "defaults": {"process": {"cwd": "/srv"}}}],
+			"services": [{
+				"name": "second",
+				"process": {"exec": "second", "user": "root", "environments": {"B": "own"}},
+				"restart": {"strategy": "never"}
+			}]
+		}`,
+		"shared/nested/third.json": `{
+			"services": [{"name": "third", "process": {"exec": "third"}, "restart": {"strategy": "never"}}]
+		}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+
+	// Includes are relative to the including file, not the working directory.
+	t.Chdir(t.TempDir())
+	var cfg Config
+	err := ReadParsedConfig(filepath.Join(dir, "ella.json"), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0)
+	services := make(map[string]Service)
+	for _, s := range cfg.Services {
+		names = append(names, s.Name)
+		services[s.Name] = s
+	}
+	expected := []string{"first", "third", "second", "main"}
+	if !slices.Equal(names, expected) {
+		t.Fatalf("unexpected services: expected: %v received: %v", expected, names)
+	}
+
+	if services["second"].Process.User != "root" {
+		t.Errorf("defaults override the user: %v", services["second"].Process.User)
+	}
+	env := services["second"].Process.Environments.(map[string]any)
+	if env["A"] != "a" || env["B"] != "own" {
+		t.Errorf("unexpected environments: %v", env)
+	}
+	third := services["third"].Process
+	if third.User != "nobody" || third.Cwd != "/srv" {
+		t.Errorf("defaults aren't applied: %v %v", third.User, third.Cwd)
+	}
+	if services["main"].Process.User != "!inherit" {
+		t.Errorf("defaults are applied to other files: %v", services["main"].Process.User)
+	}
+
+	// The same file through another path is still a cycle.
+	os.Symlink(dir, filepath.Join(dir, "link"))
+	os.WriteFile(
+		filepath.Join(dir, "conf.d/first.json"),
+		[]byte(`{"include": ["../link/ella.json"], "services": []}`), 0644,
+	)
+	err = ReadParsedConfig(filepath.Join(dir, "ella.json"), &cfg)
+	if err == nil || !strings.Contains(err.Error(), "circular inclusion") {
+		t.Errorf("expected a circular inclusion error: %v", err)
+	}
+}
+
+func TestReadParsedConfigEnvFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"ella.json": `{
+			"include": [{
+				"path": "conf.d/*.json",
+				"defaults": {"process": {"environmentFiles": ["defaults.env"]}}
+			}],
+			"templates": {"web": {"process": {"environmentFiles": ["-web.env", "/etc/web.env"]}}},
+			"services": []
+		}`,
+		"conf.d/app.json": `{
+			"services": [
+				{"name": "app", "process": {"exec": "app", "environmentFiles": ["app.env"]}, "restart": {"strategy": "never"}},
+				{"name": "web", "extends": "web", "process": {"exec": "web"}, "restart": {"strategy": "never"}},
+				{"name": "worker", "process": {"exec": "worker"}, "restart": {"strategy": "never"}}
+			]
+		}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+
+	// Environment files are relative to the file declaring them, not the
+	// working directory.
+	t.Chdir(t.TempDir())
+	var cfg Config
+	err := ReadParsedConfig(filepath.Join(dir, "ella.json"), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]string{
+		"app":    {filepath.Join(dir, "conf.d/app.env")},
+		"web":    {"-" + filepath.Join(dir, "web.env"), "/etc/web.env"},
+		"worker": {filepath.Join(dir, "defaults.env")},
+	}
+	if len(cfg.Services) != len(expected) {
+		t.Fatalf("unexpected services: %v", cfg.Services)
+	}
+	for _, s := range cfg.Services {
+		if !slices.Equal(s.Process.EnvironmentFiles, expected[s.Name]) {
+			t.Errorf(
+				"%s: unexpected environment files: expected: %v received: %v",
+				s.Name, expected[s.Name], s.Process.EnvironmentFiles,
+			)
+		}
+	}
+}
+
+func TestReadParsedConfigTemplates(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ella.json")
+	write := func(content string) {
+		os.WriteFile(path, []byte(content), 0644)
+	}
+
+	write(`{
+		"include": [{"path": "workers.json", "defaults": {"process": {"cwd": "/default", "user": "nobody"}}}],
+		"templates": {
+			"base": {
+				"process": {"exec": "worker", "environments": {"A": "base", "B": "base"}, "limits": {"nofile": 1024}, "readOnlyPaths": ["/etc", "/usr"]},
+				"restart": {"strategy": "always"}
+			},
+			"app": {
+				"extends": "base",
+				"process": {"cwd": "/app", "environments": {"B": "app"}}
+			}
+		},
+		"services": [{"name": "main", "extends": ["base", "app"], "process": {"stdout": false}}]
+	}`)
+	os.WriteFile(filepath.Join(dir, "workers.json"), []byte(`{
+		"services": [{
+			"name": "worker",
+			"extends": "app",
+			"process": {"environments": {"C": "own"}, "limits": {"nproc": 10}, "readOnlyPaths": ["/own"]}
+		}]
+	}`), 0644)
+
+	var cfg Config
+	err := ReadParsedConfig(path, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	main := cfg.Services[1].Process
+	if main.Exec != "worker" || main.Cwd != "/app" || main.Stdout {
+		t.Errorf("unexpected process: %v %v %v", main.Exec, main.Cwd, main.Stdout)
+	}
+	if _, ok := cfg.Services[1].Restart.(map[string]any); !ok {
+		t.Errorf("restart isn't extended: %v", cfg.Services[1].Restart)
+	}
+
+	// Templates take precedence over the defaults of includes, arrays and
+	// other values of the service over templates.
+	worker := cfg.Services[0].Process
+	env := worker.Environments.(map[string]any)
+	if env["A"] != "base" || env["B"] != "app" || env["C"] != "own" {
+		t.Errorf("unexpected environments: %v", env)
+	}
+	if worker.Cwd != "/app" || worker.User != "nobody" {
+		t.Errorf("unexpected process: %v %v", worker.Cwd, worker.User)
+	}
+	if worker.Limits.Nofile == nil || worker.Limits.Nproc == nil {
+		t.Errorf("limits aren't merged: %+v", worker.Limits)
+	}
+	if !slices.Equal(worker.ReadOnlyPaths, []string{"/own"}) {
+		t.Errorf("unexpected read-only paths: %v", worker.ReadOnlyPaths)
+	}
+
+	for _, invalid := range []string{
+		`{"templates": {"a": {"extends": "b"}, "b": {"extends": "a"}}, "services": [{"name": "s", "extends": "a"}]}`,
+		`{"services": [{"name": "s", "extends": "missing", "process": {"exec": "s"}, "restart": {"strategy": "never"}}]}`,
+		`{"templates": {"a": {"process": {"exec": "s"}}}, "services": [{"name": "s", "extends": "a"}]}`,
+	} {
+		write(invalid)
+		err := ReadParsedConfig(path, &cfg)
+		if err == nil {
+			t.Errorf("expected an error for %s", invalid)
+		}
+	}
+}
+
+func TestConfigGetService(t *testing.T) {
+	cfg := Config{
+		Services: []Service{{Name: "web"}, {Name: "worker@"}, {Name: "worker@eu"}},
+	}
+
+	tests := []struct {
+		name     string
+		ok       bool
+		template bool
+		instance string
+	}{
+		{"web", true, false, ""},
+		{"worker@", true, true, ""},
+		{"worker@eu", true, false, "eu"},
+		{"worker@us", true, false, "us"},
+		{"web@us", false, false, ""},
+		{"worker@../../x", false, false, ""},
+		{"worker@eu/x", false, false, ""},
+		{"worker@..", false, false, ""},
+		{"db", false, false, ""},
+	}
+	for _, test := range tests {
+		s, ok := cfg.GetService(test.name)
+		if ok != test.ok {
+			t.Fatalf("%s: expected found %v, got %v", test.name, test.ok, ok)
+		}
+		if !ok {
+			continue
+		}
+		if s.Name != test.name {
+			t.Fatalf("%s: got service %s", test.name, s.Name)
+		}
+		if s.IsTemplate() != test.template {
+			t.Fatalf("%s: expected template %v", test.name, test.template)
+		}
+		if instance := s.GetVars(0)["ELLA_INSTANCE"]; instance != test.instance {
+			t.Fatalf("%s: expected instance %s, got %s", test.name, test.instance, instance)
+		}
+	}
+}
+
+func TestValidateInstanceName(t *testing.T) {
+	for _, name := range []string{"web", "worker@eu", "worker@eu.1", "a@b@c"} {
+		err := ValidateInstanceName(name)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+	for _, name := range []string{"worker@", "worker@../x", "worker@a/b", "worker@.."} {
+		err := ValidateInstanceName(name)
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestServiceGetReplica(t *testing.T) {
+	replicas, port := 2, 5000
+	s := Service{Name: "worker@eu", Replicas: &replicas, Port: &port}
+
+	replica := s.GetReplica(2)
+	if replica.Name != "worker@eu.2" {
+		t.Fatalf("unexpected name: %s", replica.Name)
+	}
+	vars := replica.GetVars(2)
+	if vars["ELLA_REPLICA"] != "2" || vars["ELLA_INSTANCE"] != "eu" ||
+		vars["PORT"] != "5001" {
+		t.Fatalf("unexpected vars: %v", vars)
+	}
+	env := replica.GetBuiltinEnv(2)
+	if !slices.Equal(env, []string{"ELLA_REPLICA=2", "PORT=5001"}) {
+		t.Fatalf("unexpected env: %v", env)
+	}
+
+	if _, ok := s.GetVars(0)["ELLA_REPLICA"]; ok {
+		t.Fatal("service with replicas isn't a replica")
+	}
+	s = Service{Name: "web.2", Replicas: &replicas}
+	if env := s.GetBuiltinEnv(0); len(env) != 0 {
+		t.Fatalf("service named like a replica isn't a replica: %v", env)
+	}
+
+	s = Service{Name: "worker@eu.west", Replicas: &replicas}
+	replica = s.GetReplica(1)
+	vars = replica.GetVars(1)
+	if vars["ELLA_REPLICA"] != "1" || vars["ELLA_INSTANCE"] != "eu.west" ||
+		vars["ELLA_SERVICE"] != "worker@eu.west.1" {
+		t.Fatalf("unexpected vars: %v", vars)
+	}
+}
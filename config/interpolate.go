@@ -0,0 +1,109 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Looks up the value of a variable, the second value is false when it's
+// undefined.
+type Vars func(name string) (string, bool)
+
+// Looks up the variables in vars first, then in env.
+func NewVars(vars map[string]string, env []string) Vars {
+	return func(name string) (string, bool) {
+		if val, ok := vars[name]; ok {
+			return val, true
+		}
+
+		// Later definitions take precedence, the same as for exec.
+		for i := len(env) - 1; i >= 0; i-- {
+			key, val, _ := strings.Cut(env[i], "=")
+			if key == name {
+				return val, true
+			}
+		}
+
+		return "", false
+	}
+}
+
+// Returns vars with name defined as val.
+func (this Vars) With(name, val string) Vars {
+	return func(n string) (string, bool) {
+		if n == name {
+			return val, true
+		}
+
+		return this(n)
+	}
+}
+
+// Replaces ${NAME} with the value of the variable and ${NAME:-default} with
+// the default when the variable is undefined or empty. $$ is a literal $,
+// any other $ is kept as is, so shell variables pass through untouched.
+func Interpolate(s string, vars Vars) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '$')
+		if i == -1 || i == len(s)-1 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		b.WriteString(s[:i])
+
+		switch s[i+1] {
+		case '$':
+			b.WriteByte('$')
+			s = s[i+2:]
+		case '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end == -1 {
+				return "", fmt.Errorf("unterminated variable: %s", s[i:])
+			}
+
+			val, err := interpolateVar(s[i+2:i+end], vars)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(val)
+			s = s[i+end+1:]
+		default:
+			b.WriteByte('$')
+			s = s[i+1:]
+		}
+	}
+}
+
+func interpolateVar(expr string, vars Vars) (string, error) {
+	name, def, hasDefault := strings.Cut(expr, ":-")
+	if !envKeyPattern.MatchString(name) {
+		return "", fmt.Errorf("invalid variable: ${%s}", expr)
+	}
+
+	val, ok := vars(name)
+	if hasDefault && val == "" {
+		return def, nil
+	}
+	if !ok {
+		return "", fmt.Errorf("undefined variable: %s", name)
+	}
+
+	return val, nil
+}
+
+func InterpolateAll(strs []string, vars Vars) ([]string, error) {
+	ret := make([]string, 0, len(strs))
+	for _, s := range strs {
+		interpolated, err := Interpolate(s, vars)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, interpolated)
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,46 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package config
+
+import "testing"
+
+func TestInterpolate(t *testing.T) {
+	vars := NewVars(
+		map[string]string{"ELLA_SERVICE": "web"},
+		[]string{"PORT=80", "EMPTY=", "PORT=8080"},
+	).With("MAINPID", "42")
+
+	tests := map[string]string{
+		"":                        "",
+		"plain":                   "plain",
+		"${ELLA_SERVICE}.sock":    "web.sock",
+		"--port=${PORT}":          "--port=8080",
+		"${MISSING:-default}":     "default",
+		"${EMPTY:-default}":       "default",
+		"${PORT:-}":               "8080",
+		"kill -HUP ${MAINPID}":    "kill -HUP 42",
+		"$$ $HOME $ ${PORT}$":     "$ $HOME $ 8080$",
+		"${MISSING:-a:-b}${PORT}": "a:-b8080",
+		"$${PORT}":                "${PORT}",
+	}
+	for s, expected := range tests {
+		v, err := Interpolate(s, vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != expected {
+			t.Errorf(
+				"unexpected interpolation of %s: expected: %s received: %s",
+				s, expected, v,
+			)
+		}
+	}
+
+	for _, s := range []string{"${MISSING}", "${PORT", "${}", "${1A}"} {
+		_, err := Interpolate(s, vars)
+		if err == nil {
+			t.Errorf("expected an error for %s", s)
+		}
+	}
+}
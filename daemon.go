@@ -5,6 +5,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -20,20 +21,216 @@ import (
 
 // TODO: this file is becoming shit, clean it up
 type Daemon struct {
-	running atomic.Bool
-	log     bool
+	running   atomic.Bool
+	log       bool
+	formatter LogFormatter
 
+	// Instances of the template services e.g. worker@eu are created on demand
+	// from the config.
+	cfg        *config.Config
+	cgroupRoot *CgroupRoot
+
+	mu       sync.Mutex
 	services []*Service
+	// Services with replicas by name, the replicas are in services as well.
+	groups map[string]*replicaGroup
+	// Cancel the contexts the services run with.
+	cancels map[*Service]context.CancelFunc
+	// Set once the services have started running, services created later run
+	// with it.
+	ctx context.Context
+	// Running services, the daemon waits for them to clean up before it
+	// exits.
+	wg sync.WaitGroup
+}
+
+// Replicas of a service, e.g. web.1 and web.2 of the service web.
+type replicaGroup struct {
+	cfg      config.Service
+	replicas []*Service
 }
 
-func (this *Daemon) getService(name string) (*Service, error) {
+// Returns the services name refers to, all the replicas for a service with
+// replicas. Instances which haven't been started yet aren't created.
+func (this *Daemon) getServices(name string) ([]*Service, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	ss, ok := this.findServices(name)
+	if ok {
+		return ss, nil
+	}
+
+	cfg, ok := this.cfg.GetService(name)
+	if ok && !cfg.IsTemplate() {
+		return nil, fmt.Errorf("instance not started: %s", name)
+	}
+	return nil, fmt.Errorf("service not found: %s", name)
+}
+
+// Like getServices, but creates the instance name refers to unless it's
+// created already, it's used when starting services.
+func (this *Daemon) instantiate(name string) ([]*Service, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	ss, ok := this.findServices(name)
+	if ok {
+		return ss, nil
+	}
+
+	// Services of the config not created yet can only be instances.
+	err := config.ValidateInstanceName(name)
+	if err != nil {
+		return nil, err
+	}
+	cfg, ok := this.cfg.GetService(name)
+	if !ok || cfg.IsTemplate() {
+		return nil, fmt.Errorf("service not found: %s", name)
+	}
+	err = this.addService(&cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	ss, _ = this.findServices(name)
+	return ss, nil
+}
+
+// The caller must hold the lock.
+func (this *Daemon) findServices(name string) ([]*Service, bool) {
+	if group, ok := this.groups[name]; ok {
+		return slices.Clone(group.replicas), true
+	}
 	for _, s := range this.services {
 		if s.Name == name {
-			return s, nil
+			return []*Service{s}, true
 		}
 	}
 
-	return nil, fmt.Errorf("service not found: %s", name)
+	return nil, false
+}
+
+// Creates the service, or its replicas. The caller must hold the lock.
+func (this *Daemon) addService(cfg *config.Service) error {
+	if cfg.IsReplicated() {
+		group := &replicaGroup{*cfg, make([]*Service, 0)}
+		this.groups[cfg.Name] = group
+		_, _, err := this.resize(group, *cfg.Replicas)
+		return err
+	}
+
+	s, err := NewServiceFromConfig(cfg, 0, this.cfg, this.cgroupRoot)
+	if err != nil {
+		return err
+	}
+	this.register(s)
+
+	return nil
+}
+
+// Adds the service to the running services, the caller must hold the lock.
+func (this *Daemon) register(s *Service) {
+	this.services = append(this.services, s)
+	// Services created on demand may have longer names than the others.
+	if f, ok := this.formatter.(*ColorLogFormatter); ok {
+		f.Add(s.Name)
+	}
+	if this.ctx != nil {
+		ctx, cancel := context.WithCancel(this.ctx)
+		this.cancels[s] = cancel
+		this.wg.Add(1)
+		go this.runService(ctx, s, false)
+	}
+}
+
+// Stops running the service, which must be stopped already.
+func (this *Daemon) unregister(s *Service) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.services = slices.DeleteFunc(this.services, func(other *Service) bool {
+		return other == s
+	})
+	if cancel, ok := this.cancels[s]; ok {
+		cancel()
+		delete(this.cancels, s)
+	}
+}
+
+// Creates or removes replicas of the group to have n replicas, the removed
+// replicas have to be unregistered by the caller. The caller must hold the
+// lock.
+func (this *Daemon) resize(
+	group *replicaGroup, n int,
+) (added, removed []*Service, err error) {
+	for i := len(group.replicas) + 1; i <= n; i++ {
+		cfg := group.cfg.GetReplica(i)
+		s, err := NewServiceFromConfig(&cfg, i, this.cfg, this.cgroupRoot)
+		if err != nil {
+			return added, removed, fmt.Errorf("%s: %w", cfg.Name, err)
+		}
+		group.replicas = append(group.replicas, s)
+		added = append(added, s)
+		this.register(s)
+	}
+
+	if n < len(group.replicas) {
+		removed = slices.Clone(group.replicas[n:])
+		group.replicas = group.replicas[:n]
+	}
+
+	return added, removed, nil
+}
+
+// Changes the number of the replicas of the service, the new replicas are
+// started when the service is running and the removed ones are stopped.
+func (this *Daemon) scale(name string, n int) error {
+	this.mu.Lock()
+	group, ok := this.groups[name]
+	if !ok {
+		this.mu.Unlock()
+		if _, err := this.getServices(name); err != nil {
+			return err
+		}
+		return fmt.Errorf("service has no replicas: %s", name)
+	}
+	running := slices.ContainsFunc(group.replicas, func(s *Service) bool {
+		return !s.GetState().IsStopped()
+	})
+	added, removed, err := this.resize(group, n)
+	ctx := this.ctx
+	this.mu.Unlock()
+
+	errs := []error{err}
+	if running {
+		for _, s := range added {
+			err := s.Start()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.Name, err))
+			}
+		}
+	}
+	for _, s := range removed {
+		err := s.Stop()
+		if err != nil && !errors.Is(err, ServiceErrAlreadyStopped) {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name, err))
+		}
+		_, err = s.WaitState(ctx, ServiceState.IsStopped)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name, err))
+		}
+		this.unregister(s)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (this *Daemon) listServices() []*Service {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return slices.Clone(this.services)
 }
 
 func (this *Daemon) Run(
@@ -53,31 +250,37 @@ func (this *Daemon) Run(
 		return CODE_INITIALIZATION_FAILED
 	}
 
-	var code int
-	this.services, code = this.getServices(c)
+	this.cfg = c
+	this.cgroupRoot = this.getCgroupRoot(c)
+	code := this.createServices(c)
 	if code != CODE_SUCCESS {
 		return code
 	}
 
-	err = this.checkServicesToExist(c, starts)
+	startServices, err := this.resolveServices(starts)
 	if err != nil {
 		fmt.Println("error:", err)
 		return CODE_INVALID_CONFIG
 	}
 
-	socket := SocketServer{this.getService, this.services}
+	this.formatter = this.getFormatter()
+
+	socket := SocketServer{
+		this.getServices, this.instantiate, this.listServices, this.scale,
+	}
 	err = this.initVarDir()
 	if err != nil {
 		fmt.Println("error:", err)
 		return CODE_GENERAL_ERR
 	}
 
-	go this.runServices(ctx, starts)
+	this.runServices(ctx, startServices)
 
 	common.WaitAny(
 		ctx,
 		socket.Listen,
 	)
+	this.wg.Wait()
 	err = this.deinitVarDir()
 	if err != nil {
 		fmt.Println("error:", err)
@@ -108,42 +311,49 @@ func (this *Daemon) writePid(pidFile string) error {
 	)
 }
 
-func (this *Daemon) checkServicesToExist(
-	cfg *config.Config, services []string,
-) error {
-	for _, serviceName := range services {
-		_, err := this.getService(serviceName)
+func (this *Daemon) resolveServices(names []string) ([]*Service, error) {
+	services := make([]*Service, 0)
+	for _, name := range names {
+		ss, err := this.instantiate(name)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		services = append(services, ss...)
 	}
 
-	return nil
+	return services, nil
 }
 
 func (this *Daemon) runServices(
-	ctx context.Context, starts []string,
+	ctx context.Context, starts []*Service,
 ) {
-	var wg sync.WaitGroup
-	wg.Add(len(this.services))
-	for _, s := range this.services {
-		go func() {
-			defer wg.Done()
+	this.mu.Lock()
+	this.ctx = ctx
+	services := slices.Clone(this.services)
+	contexts := make([]context.Context, 0, len(services))
+	for _, s := range services {
+		ctx, cancel := context.WithCancel(ctx)
+		this.cancels[s] = cancel
+		contexts = append(contexts, ctx)
+	}
+	this.mu.Unlock()
 
-			this.runService(ctx, s, slices.Contains(starts, s.Name))
-		}()
+	for i, s := range services {
+		this.wg.Add(1)
+		go this.runService(contexts[i], s, slices.Contains(starts, s))
 	}
-	wg.Wait()
 }
 
 func (this *Daemon) runService(
 	ctx context.Context, s *Service, start bool,
 ) {
+	defer this.wg.Done()
+
 	var wg sync.WaitGroup
 	if this.log {
 		wg.Add(1)
 
-		logs := s.Logs()
+		logs := s.FormattedLogs(this.formatter)
 		go func() {
 			<-ctx.Done()
 
@@ -153,8 +363,9 @@ func (this *Daemon) runService(
 		go func() {
 			defer wg.Done()
 
+			// The logs get closed once the service stops running.
 			_, err := io.Copy(os.Stdout, logs)
-			if err != nil {
+			if err != nil && !errors.Is(err, io.ErrClosedPipe) {
 				fmt.Println("daemon:", err)
 			}
 		}()
@@ -176,16 +387,61 @@ func (this *Daemon) runService(
 	wg.Wait()
 }
 
-func (this *Daemon) getServices(c *config.Config) ([]*Service, int) {
-	services := make([]*Service, 0)
+func (this *Daemon) getFormatter() LogFormatter {
+	if !ShouldColorize(os.Stdout) {
+		return PlainLogFormatter{}
+	}
+
+	names := make([]string, 0)
+	for _, s := range this.services {
+		names = append(names, s.Name)
+	}
+
+	return NewColorLogFormatter(names)
+}
+
+// Cgroups are only set up when a service asks for resource limits, which
+// moves ella into a cgroup of its own and enables the controllers for its
+// services. They're optional, only worth a warning when unavailable.
+func (this *Daemon) getCgroupRoot(c *config.Config) *CgroupRoot {
+	if !slices.ContainsFunc(c.Services, func(cfg config.Service) bool {
+		return cfg.Resources != nil
+	}) {
+		return nil
+	}
+
+	root, err := NewCgroupRoot()
+	if err != nil {
+		fmt.Println(
+			"warning: cgroup v2 delegation unavailable, ignoring resources:", err,
+		)
+		return nil
+	}
+
+	return root
+}
+
+// Template services are only checked to be valid, their instances are
+// created on demand.
+func (this *Daemon) createServices(c *config.Config) int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.services = make([]*Service, 0)
+	this.groups = make(map[string]*replicaGroup)
+	this.cancels = make(map[*Service]context.CancelFunc)
 	for _, cfg := range c.Services {
-		s, err := NewServiceFromConfig(&cfg)
+		var err error
+		if cfg.IsTemplate() {
+			_, err = NewServiceFromConfig(&cfg, 0, c, this.cgroupRoot)
+		} else {
+			err = this.addService(&cfg)
+		}
 		if err != nil {
-			fmt.Println("error:", err)
-			return nil, CODE_INITIALIZATION_FAILED
+			fmt.Printf("error: %s: %s\n", cfg.Name, err)
+			return CODE_INITIALIZATION_FAILED
 		}
-		services = append(services, s)
 	}
 
-	return services, CODE_SUCCESS
+	return CODE_SUCCESS
 }
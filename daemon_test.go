@@ -0,0 +1,294 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thekhanj/ella/common"
+	"github.com/thekhanj/ella/config"
+)
+
+// Creates the services of the config without running them.
+func newTestDaemon(t *testing.T, services string) *Daemon {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "ella.json")
+	err := os.WriteFile(path, []byte(`{"services": `+services+`}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg config.Config
+	err = config.ReadParsedConfig(path, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &Daemon{cfg: &cfg}
+	code := d.createServices(&cfg)
+	if code != CODE_SUCCESS {
+		t.Fatalf("creating the services failed: %d", code)
+	}
+
+	return d
+}
+
+func TestDaemonInstances(t *testing.T) {
+	d := newTestDaemon(t, `[{
+		"name": "worker@",
+		"process": {"exec": "sleep 1", "user": "!inherit"},
+		"restart": {"strategy": "never"}
+	}]`)
+
+	// Looking an instance up doesn't create it.
+	for _, name := range []string{"worker@eu", "worker@typo"} {
+		_, err := d.getServices(name)
+		if err == nil {
+			t.Fatalf("%s: expected the instance not to be found", name)
+		}
+	}
+	if n := len(d.listServices()); n != 0 {
+		t.Fatalf("expected no services, got %d", n)
+	}
+
+	for _, name := range []string{
+		"worker@", "worker@../../x", "worker@eu/x", "worker@..", "db@eu",
+	} {
+		_, err := d.instantiate(name)
+		if err == nil {
+			t.Fatalf("%s: expected the instance to be refused", name)
+		}
+	}
+	if n := len(d.listServices()); n != 0 {
+		t.Fatalf("expected no services, got %d", n)
+	}
+
+	ss, err := d.instantiate("worker@eu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ss) != 1 || ss[0].Name != "worker@eu" {
+		t.Fatalf("unexpected services: %v", ss)
+	}
+	again, err := d.getServices("worker@eu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 1 || again[0] != ss[0] {
+		t.Fatal("expected the created instance to be returned")
+	}
+	again, err = d.instantiate("worker@eu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 1 || again[0] != ss[0] || len(d.listServices()) != 1 {
+		t.Fatal("expected the instance to be created once")
+	}
+}
+
+func TestDaemonScale(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := newTestDaemon(t, `[{
+		"name": "api.v1",
+		"replicas": 2,
+		"port": 5000,
+		"process": {"exec": "sleep 10", "user": "!inherit"},
+		"restart": {"strategy": "never"}
+	}, {
+		"name": "db",
+		"process": {"exec": "sleep 10", "user": "!inherit"},
+		"restart": {"strategy": "never"}
+	}]`)
+	d.runServices(ctx, nil)
+	defer d.wg.Wait()
+	defer cancel()
+
+	replicas := func() []*Service {
+		ss, err := d.getServices("api.v1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ss
+	}
+	check := func(ss []*Service) {
+		t.Helper()
+
+		for i, s := range ss {
+			n := i + 1
+			if s.Name != fmt.Sprintf("api.v1.%d", n) || s.Replica != n {
+				t.Fatalf("unexpected replica %d: %s", s.Replica, s.Name)
+			}
+			for _, env := range []string{
+				fmt.Sprintf("ELLA_REPLICA=%d", n),
+				fmt.Sprintf("PORT=%d", 5000+i),
+			} {
+				if !slices.Contains(s.Spec.Env, env) {
+					t.Fatalf("%s: %s not found in %v", s.Name, env, s.Spec.Env)
+				}
+			}
+		}
+	}
+	check(replicas())
+
+	for _, s := range replicas() {
+		err := s.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitActive(t, ctx, s)
+	}
+
+	err := d.scale("api.v1", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss := replicas()
+	if len(ss) != 3 {
+		t.Fatalf("expected 3 replicas, got %d", len(ss))
+	}
+	check(ss)
+	// Replicas added to a running service are started as well.
+	waitActive(t, ctx, ss[2])
+
+	err = d.scale("api.v1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(replicas())
+	if n := len(replicas()); n != 1 {
+		t.Fatalf("expected 1 replica, got %d", n)
+	}
+	for _, s := range ss[1:] {
+		if state := s.GetState(); !state.IsStopped() {
+			t.Fatalf("%s: expected the removed replica to stop, got: %s",
+				s.Name, state.Name())
+		}
+	}
+	if n := len(d.listServices()); n != 2 {
+		t.Fatalf("expected the removed replicas to be unregistered, got %d", n)
+	}
+
+	err = d.scale("db", 2)
+	if err == nil {
+		t.Fatal("expected scaling a service without replicas to fail")
+	}
+	err = d.scale("cache", 2)
+	if err == nil {
+		t.Fatal("expected scaling an unknown service to fail")
+	}
+}
+
+func TestDaemonCgroupRoot(t *testing.T) {
+	before, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		t.Skip("cgroups unavailable")
+	}
+
+	d := newTestDaemon(t, `[{
+		"name": "web",
+		"process": {"exec": "sleep 1", "user": "!inherit"},
+		"restart": {"strategy": "never"}
+	}]`)
+	if root := d.getCgroupRoot(d.cfg); root != nil {
+		t.Fatal("expected no cgroup root without resource limits")
+	}
+	after, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Fatalf("expected ella to stay in its cgroup, moved to: %s", after)
+	}
+}
+
+func TestDaemonFormatterWidth(t *testing.T) {
+	d := newTestDaemon(t, `[{
+		"name": "web",
+		"replicas": 1,
+		"process": {"exec": "sleep 10", "user": "!inherit"},
+		"restart": {"strategy": "never"}
+	}]`)
+	f := NewColorLogFormatter([]string{"web.1"})
+	d.formatter = f
+
+	// Replicas added later have longer names.
+	err := d.scale("web", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := f.Format("web.1", LogLine{LogStreamStdout, "x"})
+	if !strings.Contains(line, "web.1 "+ansiReset+" | x") {
+		t.Fatalf("expected the name to be padded to web.10: %q", line)
+	}
+}
+
+func TestDaemonScaleRuntimeDirectory(t *testing.T) {
+	dir := fmt.Sprintf("ella-test-%d", os.Getpid())
+	path := filepath.Join(common.GetRuntimeDir(), dir)
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Skip("runtime directory unavailable:", err)
+	}
+	os.Remove(path)
+	defer os.RemoveAll(path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := newTestDaemon(t, `[{
+		"name": "web",
+		"replicas": 2,
+		"process": {
+			"exec": "sleep 10", "user": "!inherit", "runtimeDirectory": "`+dir+`"
+		},
+		"restart": {"strategy": "never"}
+	}]`)
+	d.runServices(ctx, nil)
+	defer d.wg.Wait()
+	defer cancel()
+
+	ss, err := d.getServices("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range ss {
+		err := s.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitActive(t, ctx, s)
+	}
+	if !slices.Contains(ss[0].Spec.Env, "RUNTIME_DIRECTORY="+path) {
+		t.Fatalf("unexpected environment: %v", ss[0].Spec.Env)
+	}
+
+	// The replicas share the directory, the remaining one still uses it.
+	err = d.scale("web", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected the runtime directory to be kept: %s", err)
+	}
+
+	err = ss[0].Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ss[0].WaitState(ctx, ServiceState.IsStopped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 50 {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("expected the runtime directory to be removed by the last replica")
+}
@@ -0,0 +1,287 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/thekhanj/ella/common"
+	"github.com/thekhanj/ella/config"
+)
+
+// Name of the file descriptors stored without FDNAME.
+const fdStoreDefaultName = "stored"
+
+// Most file descriptors a single message can carry, SCM_MAX_FD on linux.
+const fdStoreMaxMsgFds = 253
+
+type storedFd struct {
+	name string
+	file *os.File
+}
+
+// File descriptors the processes of a service hand to ella over the notify
+// socket with FDSTORE=1, see sd_pid_notify_with_fds(3). They're passed back
+// to the next processes of the service. Other notify messages are ignored,
+// and so are the messages of other processes than the main process of the
+// service and its children.
+type FdStore struct {
+	// Path of the notify socket, passed to the processes as NOTIFY_SOCKET.
+	Path string
+	Max  int
+	// Owner of the notify socket, only the processes of the service can
+	// send to it.
+	Uid uint32
+	Gid uint32
+
+	mu   sync.Mutex
+	conn *net.UnixConn
+	fds  []storedFd
+}
+
+// Creates the notify socket unless it's already created. It's bound to a
+// temporary path first, and only moved into place once only its owner can
+// send to it.
+func (this *FdStore) Open() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.conn != nil {
+		return nil
+	}
+
+	tmp := this.Path + ".tmp"
+	os.Remove(tmp)
+	conn, err := net.ListenUnixgram(
+		"unixgram", &net.UnixAddr{Name: tmp, Net: "unixgram"},
+	)
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(tmp, 0600)
+	if err == nil {
+		err = os.Lchown(tmp, int(this.Uid), int(this.Gid))
+	}
+	if err == nil {
+		err = enablePassCred(conn)
+	}
+	if err == nil {
+		err = os.Rename(tmp, this.Path)
+	}
+	if err != nil {
+		conn.Close()
+		os.Remove(tmp)
+		return err
+	}
+	this.conn = conn
+
+	return nil
+}
+
+// Handles the messages sent to the notify socket until the context is
+// canceled, and then removes the socket. mainPid returns the pid of the
+// main process of the service.
+func (this *FdStore) Serve(
+	ctx context.Context, log *log.Logger, mainPid func() (int, error),
+) error {
+	err := this.Open()
+	if err != nil {
+		return err
+	}
+
+	this.mu.Lock()
+	conn := this.conn
+	this.mu.Unlock()
+	defer func() {
+		this.mu.Lock()
+		defer this.mu.Unlock()
+
+		conn.Close()
+		os.Remove(this.Path)
+		this.conn = nil
+	}()
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	buf := make([]byte, 4096)
+	oob := make(
+		[]byte,
+		syscall.CmsgSpace(fdStoreMaxMsgFds*4)+syscall.CmsgSpace(fdStoreCredSize),
+	)
+	for {
+		n, oobn, flags, _, err := conn.ReadMsgUnix(buf, oob)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			log.Printf("invalid notify message: %s", err)
+			continue
+		}
+		fds := parseUnixRights(msgs)
+		pid, ok := parseSenderPid(msgs)
+		if !ok || !isDescendant(pid, mainPid) {
+			closeFds(fds)
+			log.Printf("notify message of process %d ignored", pid)
+			continue
+		}
+		if flags&syscall.MSG_CTRUNC != 0 {
+			log.Print("notify message truncated, file descriptors dropped")
+		}
+		this.handle(log, string(buf[:n]), fds)
+	}
+}
+
+func parseUnixRights(msgs []syscall.SocketControlMessage) []int {
+	fds := make([]int, 0)
+	for _, msg := range msgs {
+		rights, err := syscall.ParseUnixRights(&msg)
+		if err != nil {
+			continue
+		}
+		fds = append(fds, rights...)
+	}
+
+	return fds
+}
+
+func closeFds(fds []int) {
+	for _, fd := range fds {
+		syscall.Close(fd)
+	}
+}
+
+// Whether the process is the main process or one of its descendants.
+func isDescendant(pid int, mainPid func() (int, error)) bool {
+	main, err := mainPid()
+	if err != nil {
+		return false
+	}
+
+	for pid > 1 {
+		if pid == main {
+			return true
+		}
+
+		pid, err = parentPid(pid)
+		if err != nil {
+			return false
+		}
+	}
+
+	return false
+}
+
+func (this *FdStore) handle(log *log.Logger, msg string, fds []int) {
+	vars := make(map[string]string)
+	for _, line := range strings.Split(msg, "\n") {
+		key, val, ok := strings.Cut(line, "=")
+		if ok {
+			vars[key] = val
+		}
+	}
+	name := fdStoreDefaultName
+	if vars["FDNAME"] != "" {
+		name = vars["FDNAME"]
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if vars["FDSTOREREMOVE"] == "1" {
+		this.fds = slices.DeleteFunc(this.fds, func(fd storedFd) bool {
+			if fd.name != name {
+				return false
+			}
+			fd.file.Close()
+			return true
+		})
+	}
+
+	for _, fd := range fds {
+		if vars["FDSTORE"] != "1" {
+			syscall.Close(fd)
+			continue
+		}
+		if len(this.fds) >= this.Max {
+			syscall.Close(fd)
+			log.Printf("file descriptor store full, dropped %s", name)
+			continue
+		}
+
+		// Only passed to the processes of the service, explicitly.
+		syscall.CloseOnExec(fd)
+		file := os.NewFile(uintptr(fd), name)
+		this.fds = append(this.fds, storedFd{name, file})
+	}
+}
+
+// Returns the stored files and their names.
+func (this *FdStore) Files() ([]*os.File, []string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	files := make([]*os.File, 0, len(this.fds))
+	names := make([]string, 0, len(this.fds))
+	for _, fd := range this.fds {
+		files = append(files, fd.file)
+		names = append(names, fd.name)
+	}
+
+	return files, names
+}
+
+// Closes the stored files.
+func (this *FdStore) Clear() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	errs := make([]error, 0)
+	for _, fd := range this.fds {
+		errs = append(errs, fd.file.Close())
+	}
+	this.fds = nil
+
+	return errors.Join(errs...)
+}
+
+func (this *FdStore) EnvVar() string {
+	return fmt.Sprintf("NOTIFY_SOCKET=%s", this.Path)
+}
+
+// The notify socket is created in the runtime directory of the daemon.
+func NewFdStoreFromConfig(
+	cfg *config.Service, uid, gid uint32,
+) *FdStore {
+	path := filepath.Join(
+		common.GetVarDir(os.Getpid()), fmt.Sprintf("%s.notify", cfg.Name),
+	)
+
+	return &FdStore{
+		Path: path,
+		Max:  cfg.FileDescriptorStoreMax,
+		Uid:  uid,
+		Gid:  gid,
+
+		mu:   sync.Mutex{},
+		conn: nil,
+		fds:  make([]storedFd, 0),
+	}
+}
@@ -0,0 +1,72 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Size of the credentials of the sender attached to each message.
+const fdStoreCredSize = syscall.SizeofUcred
+
+// Makes the kernel attach the credentials of the sender to each message, see
+// unix(7).
+func enablePassCred(conn *net.UnixConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var optErr error
+	err = raw.Control(func(fd uintptr) {
+		optErr = syscall.SetsockoptInt(
+			int(fd), syscall.SOL_SOCKET, syscall.SO_PASSCRED, 1,
+		)
+	})
+	if err != nil {
+		return err
+	}
+
+	return optErr
+}
+
+func parseSenderPid(msgs []syscall.SocketControlMessage) (int, bool) {
+	for _, msg := range msgs {
+		cred, err := syscall.ParseUnixCredentials(&msg)
+		if err == nil {
+			return int(cred.Pid), true
+		}
+	}
+
+	return 0, false
+}
+
+// See proc_pid_stat(5).
+func parentPid(pid int) (int, error) {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+
+	// The command name in parentheses may contain spaces, the state and the
+	// parent pid come right after it.
+	i := bytes.LastIndexByte(b, ')')
+	if i < 0 {
+		return 0, fmt.Errorf("invalid stat of process %d", pid)
+	}
+	fields := strings.Fields(string(b[i+1:]))
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("invalid stat of process %d", pid)
+	}
+
+	return strconv.Atoi(fields[1])
+}
@@ -0,0 +1,30 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+var fdStoreErrUnsupported = errors.New(
+	"the file descriptor store is only supported on linux",
+)
+
+const fdStoreCredSize = 0
+
+func enablePassCred(conn *net.UnixConn) error {
+	return fdStoreErrUnsupported
+}
+
+func parseSenderPid(msgs []syscall.SocketControlMessage) (int, bool) {
+	return 0, false
+}
+
+func parentPid(pid int) (int, error) {
+	return 0, fdStoreErrUnsupported
+}
@@ -0,0 +1,194 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFdStore(t *testing.T) {
+	store := &FdStore{
+		Path: filepath.Join(t.TempDir(), "test.notify"),
+		Max:  2,
+		Uid:  uint32(os.Getuid()),
+		Gid:  uint32(os.Getgid()),
+	}
+	err := store.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(store.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("unexpected mode of the notify socket: %s", info.Mode().Perm())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	// The test is a child of the main process.
+	mainPid := func() (int, error) {
+		return os.Getppid(), nil
+	}
+	go func() {
+		served <- store.Serve(ctx, log.New(io.Discard, "", 0), mainPid)
+	}()
+
+	sock, err := syscall.Socket(syscall.AF_UNIX, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(sock)
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	send := func(msg string, files ...*os.File) {
+		fds := make([]int, 0)
+		for _, f := range files {
+			fds = append(fds, int(f.Fd()))
+		}
+		err := syscall.Sendmsg(
+			sock, []byte(msg), syscall.UnixRights(fds...),
+			&syscall.SockaddrUnix{Name: store.Path}, 0,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitNames := func(expected ...string) {
+		for range 100 {
+			_, names := store.Files()
+			if slices.Equal(names, expected) {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		_, names := store.Files()
+		t.Fatalf("expected stored %v, got: %v", expected, names)
+	}
+
+	send("FDSTORE=1\nFDNAME=pipe", r)
+	send("FDSTORE=1", w, w)
+	waitNames("pipe", "stored")
+
+	send("READY=1", w)
+	send("FDSTOREREMOVE=1\nFDNAME=pipe")
+	waitNames("stored")
+
+	files, _ := store.Files()
+	_, err = files[0].Write([]byte("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 1)
+	if _, err := r.Read(b); err != nil || b[0] != 'x' {
+		t.Fatalf("expected the stored pipe to be usable, got: %v", err)
+	}
+
+	err = store.Clear()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitNames()
+
+	cancel()
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(store.Path); !os.IsNotExist(err) {
+		t.Fatal("expected the notify socket to be removed")
+	}
+}
+
+func TestFdStoreSender(t *testing.T) {
+	store := &FdStore{
+		Path: filepath.Join(t.TempDir(), "test.notify"),
+		Max:  2,
+		Uid:  uint32(os.Getuid()),
+		Gid:  uint32(os.Getgid()),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Another process, which the test isn't a child of.
+	other := NewProc("sleep", "10")
+	go other.Run(ctx)
+	states := other.Sub()
+	for state := range states {
+		if state == ProcStateStarted {
+			break
+		}
+	}
+	go func() {
+		for range states {
+		}
+	}()
+	process, err := other.GetProcess()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mainPid := func() (int, error) {
+		return process.Pid, nil
+	}
+
+	logR, logW := io.Pipe()
+	defer logR.Close()
+	logs := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(logR)
+		for scanner.Scan() {
+			logs <- scanner.Text()
+		}
+	}()
+	err = store.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go store.Serve(ctx, log.New(logW, "", 0), mainPid)
+
+	sock, err := syscall.Socket(syscall.AF_UNIX, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(sock)
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	err = syscall.Sendmsg(
+		sock, []byte("FDSTORE=1"), syscall.UnixRights(int(r.Fd())),
+		&syscall.SockaddrUnix{Name: store.Path}, 0,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case line := <-logs:
+		if !strings.Contains(line, "ignored") {
+			t.Fatalf("unexpected log: %s", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the message to be logged as ignored")
+	}
+	if files, _ := store.Files(); len(files) != 0 {
+		t.Fatal("expected the message of another process to be ignored")
+	}
+}
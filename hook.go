@@ -0,0 +1,152 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/thekhanj/ella/config"
+)
+
+// A command run around the process of a service, e.g. before it starts.
+type Hook struct {
+	createProc CreateProc
+	// Arguments of the command, interpolated once MAINPID is known.
+	args    []string
+	vars    config.Vars
+	timeout time.Duration
+}
+
+// Runs the command until it exits or ctx is canceled, its output is added to
+// procs unless it's nil. mainPid is 0 when the process isn't running.
+func (this *Hook) Run(ctx context.Context, procs *Procs, mainPid int) error {
+	args, err := config.InterpolateAll(
+		this.args, this.vars.With("MAINPID", strconv.Itoa(mainPid)),
+	)
+	if err != nil {
+		return err
+	}
+
+	proc := this.createProc(args[0], args[1:]...)
+	if procs != nil {
+		procs.Add(proc)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, this.timeout)
+	defer cancel()
+
+	err = proc.Run(ctx)
+	if err != nil {
+		return err
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s timed out after %s", args[0], this.timeout)
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s: %w", args[0], ctx.Err())
+	}
+
+	exit, err := proc.GetExit()
+	if err != nil {
+		return err
+	}
+	if exit.Signaled() || exit.Code != 0 {
+		return fmt.Errorf("%s %s", args[0], exit.String())
+	}
+
+	return nil
+}
+
+// Runs the hooks in order, up to the first failing one.
+func runHooks(
+	ctx context.Context, hooks []*Hook, procs *Procs, mainPid int,
+) error {
+	for _, hook := range hooks {
+		err := hook.Run(ctx, procs, mainPid)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Hooks of a service by when they run.
+type ServiceHooks struct {
+	StartPre   []*Hook
+	StartPost  []*Hook
+	StopPost   []*Hook
+	ReloadPost []*Hook
+}
+
+// Interpolates the commands with a placeholder pid, so undefined variables
+// are reported while loading the config.
+func NewHookFromConfig(
+	cfg *config.Hook, createProc CreateProc, vars config.Vars,
+) (*Hook, error) {
+	args, err := ParseCommandLine(string(cfg.Exec))
+	if err != nil {
+		return nil, err
+	}
+	_, err = config.InterpolateAll(args, vars.With("MAINPID", "0"))
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := time.ParseDuration(string(cfg.Timeout))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Hook{
+		createProc: createProc,
+		args:       args,
+		vars:       vars,
+		timeout:    timeout,
+	}, nil
+}
+
+func NewServiceHooksFromConfig(
+	cfg *config.Proc, createProc CreateProc, vars config.Vars,
+) (*ServiceHooks, error) {
+	newHooks := func(name string, cfgs []config.Hook) ([]*Hook, error) {
+		hooks := make([]*Hook, 0)
+		for i := range cfgs {
+			hook, err := NewHookFromConfig(&cfgs[i], createProc, vars)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			hooks = append(hooks, hook)
+		}
+
+		return hooks, nil
+	}
+
+	startPre, err := newHooks("execStartPre", cfg.ExecStartPre)
+	if err != nil {
+		return nil, err
+	}
+	startPost, err := newHooks("execStartPost", cfg.ExecStartPost)
+	if err != nil {
+		return nil, err
+	}
+	stopPost, err := newHooks("execStopPost", cfg.ExecStopPost)
+	if err != nil {
+		return nil, err
+	}
+	reloadPost, err := newHooks("execReloadPost", cfg.ExecReloadPost)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ServiceHooks{
+		StartPre:   startPre,
+		StartPost:  startPost,
+		StopPost:   stopPost,
+		ReloadPost: reloadPost,
+	}, nil
+}
@@ -0,0 +1,237 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/thekhanj/ella/config"
+)
+
+func newTestHook(t *testing.T, exec string, timeout time.Duration) *Hook {
+	t.Helper()
+
+	hook, err := NewHookFromConfig(
+		&config.Hook{
+			Exec:    config.ProcExec(exec),
+			Timeout: config.Duration(timeout.String()),
+		},
+		NewProc, config.NewVars(nil, nil),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hook
+}
+
+func TestHookRun(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	hook := newTestHook(t, "sh -c 'echo ${MAINPID} > "+out+"'", time.Second)
+	err := hook.Run(context.Background(), nil, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(b)) != "42" {
+		t.Fatalf("expected MAINPID to be interpolated, got: %s", b)
+	}
+
+	err = newTestHook(t, "false", time.Second).Run(context.Background(), nil, 0)
+	if err == nil {
+		t.Fatal("expected a failing hook to fail")
+	}
+
+	err = newTestHook(t, "sleep 10", 100*time.Millisecond).Run(context.Background(), nil, 0)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected the hook to time out, got: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = newTestHook(t, "sleep 10", time.Second).Run(ctx, nil, 0)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the hook to be canceled, got: %v", err)
+	}
+}
+
+func TestServiceHooks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	cleaned := filepath.Join(dir, "cleaned")
+	hooks := &ServiceHooks{
+		StartPre: []*Hook{newTestHook(t, "false", time.Second)},
+		StopPost: []*Hook{newTestHook(t, "touch "+cleaned, time.Second)},
+	}
+	exec := func() (*Proc, error) {
+		return NewProc("sleep", "10"), nil
+	}
+	watchdog := NewSimpleWatchdog(
+		exec,
+		&StopSignalProcAction{timeout: time.Second, signal: syscall.SIGTERM},
+		&ReloadSignalProcAction{signal: syscall.SIGHUP},
+		nil,
+	)
+	s := NewService("app", watchdog, ServiceOptions{Hooks: hooks})
+	go s.Run(ctx)
+
+	err := s.Start()
+	if err == nil {
+		t.Fatal("expected the start to fail with execStartPre")
+	}
+	if state := s.GetState(); state != ServiceStateFailed {
+		t.Fatalf("expected the service to fail, got: %s", state.Name())
+	}
+	if _, err := os.Stat(cleaned); err != nil {
+		t.Fatal("expected execStopPost to run after the failed start")
+	}
+	if _, err := watchdog.Procs().Last(); err == nil {
+		t.Fatal("expected the process not to be started")
+	}
+
+	os.Remove(cleaned)
+	hooks.StartPre = nil
+	err = s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.WaitState(ctx, func(state ServiceState) bool {
+		return state == ServiceStateActive
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.WaitState(ctx, ServiceState.IsStopped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cleaned); err != nil {
+		t.Fatal("expected execStopPost to run after the process stopped")
+	}
+}
+
+func TestServiceStartPostFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hooks := &ServiceHooks{
+		StartPost: []*Hook{newTestHook(t, "false", time.Second)},
+	}
+	s := newTestService(ctx, "exec sleep 10", ServiceOptions{Hooks: hooks})
+
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.WaitState(ctx, func(state ServiceState) bool {
+		return state == ServiceStateFailed
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.Failures()); n != 1 {
+		t.Fatalf("expected the failure to be recorded, got %d failures", n)
+	}
+}
+
+func TestServiceHooksReplaced(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cleaned := filepath.Join(t.TempDir(), "cleaned")
+	hooks := &ServiceHooks{
+		StopPost: []*Hook{newTestHook(t, "touch "+cleaned, time.Second)},
+	}
+	s := newTestService(ctx, "exec sleep 10", ServiceOptions{
+		Hooks:      hooks,
+		StartFirst: true,
+		MinReady:   100 * time.Millisecond,
+	})
+
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitActive(t, ctx, s)
+	err = s.Restart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	// The replaced process is reported asynchronously.
+	for range 50 {
+		if len(s.History()) != 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(s.History()) == 0 {
+		t.Fatal("expected the replaced process to exit")
+	}
+	if _, err := os.Stat(cleaned); err == nil {
+		t.Fatal("expected execStopPost not to run for the replaced process")
+	}
+}
+
+func TestServiceStopDuringStartHooks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sleep := []*Hook{newTestHook(t, "sleep 10", 10*time.Second)}
+	tests := map[string]*ServiceHooks{
+		"execStartPre":  {StartPre: sleep},
+		"execStartPost": {StartPost: sleep},
+	}
+	for name, hooks := range tests {
+		s := newTestService(ctx, "exec sleep 10", ServiceOptions{Hooks: hooks})
+
+		started := make(chan error, 1)
+		go func() {
+			started <- s.Start()
+		}()
+		_, err := s.WaitState(ctx, func(state ServiceState) bool {
+			return state == ServiceStateActivating
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Let the hook start.
+		time.Sleep(100 * time.Millisecond)
+
+		now := time.Now()
+		err = s.Stop()
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		<-started
+		_, err = s.WaitState(ctx, ServiceState.IsStopped)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(now); elapsed > 2*time.Second {
+			t.Fatalf("%s: expected stop not to wait for the hook: %s", name, elapsed)
+		}
+		if state := s.GetState(); state != ServiceStateInactive {
+			t.Fatalf("%s: expected the service to be stopped, got: %s",
+				name, state.Name())
+		}
+	}
+}
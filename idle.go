@@ -0,0 +1,82 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/thekhanj/ella/config"
+)
+
+// How often the activity of a service with an idle timeout is checked, the
+// connections are only sampled then so the shorter ones may go unnoticed.
+const idleCheckInterval = time.Second
+
+// Tells when a service has been idle for too long, by the connections to
+// its sockets or by the output of its process. It's written the output of
+// the process to.
+type IdleMonitor struct {
+	Timeout  time.Duration
+	Activity config.ServiceIdleActivity
+
+	sockets *SocketActivation
+	// Unix time in nanoseconds of the last activity.
+	lastActive atomic.Int64
+}
+
+func (this *IdleMonitor) Write(p []byte) (int, error) {
+	if this.Activity == config.ServiceIdleActivityOutput {
+		this.Touch(time.Now())
+	}
+
+	return len(p), nil
+}
+
+func (this *IdleMonitor) Close() error {
+	return nil
+}
+
+// Records activity at now, e.g. when the service becomes active.
+func (this *IdleMonitor) Touch(now time.Time) {
+	this.lastActive.Store(now.UnixNano())
+}
+
+// Checks the activity of the service, and returns whether it has been idle
+// for the timeout at now.
+func (this *IdleMonitor) Check(now time.Time) (bool, error) {
+	if this.Activity == config.ServiceIdleActivityConnections {
+		n, err := this.sockets.Connections()
+		if err != nil {
+			return false, err
+		}
+		if n > 0 {
+			this.Touch(now)
+		}
+	}
+
+	last := time.Unix(0, this.lastActive.Load())
+	return now.Sub(last) >= this.Timeout, nil
+}
+
+func NewIdleMonitorFromConfig(
+	cfg *config.Service, sockets *SocketActivation,
+) (*IdleMonitor, error) {
+	timeout, err := time.ParseDuration(string(*cfg.IdleTimeout))
+	if err != nil {
+		return nil, err
+	}
+	if sockets == nil {
+		return nil, errors.New("idleTimeout requires sockets")
+	}
+
+	return &IdleMonitor{
+		Timeout:  timeout,
+		Activity: cfg.IdleActivity,
+
+		sockets:    sockets,
+		lastActive: atomic.Int64{},
+	}, nil
+}
@@ -0,0 +1,136 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/thekhanj/ella/config"
+)
+
+func TestIdleMonitorOutput(t *testing.T) {
+	m := &IdleMonitor{
+		Timeout:  time.Minute,
+		Activity: config.ServiceIdleActivityOutput,
+	}
+	start := time.Now()
+	m.Touch(start)
+
+	idle, _ := m.Check(start.Add(30 * time.Second))
+	if idle {
+		t.Fatal("expected the service not to be idle before the timeout")
+	}
+	m.Write([]byte("output\n"))
+	idle, _ = m.Check(start.Add(time.Minute))
+	if idle {
+		t.Fatal("expected the output to keep the service from being idle")
+	}
+	idle, _ = m.Check(time.Now().Add(time.Minute))
+	if !idle {
+		t.Fatal("expected the service to be idle after the timeout")
+	}
+}
+
+func TestIdleMonitorConnections(t *testing.T) {
+	sockets := &SocketActivation{
+		Sockets: []*ServiceSocket{
+			{Name: "http", Type: config.SocketTypeTcp, Address: "127.0.0.1:0"},
+		},
+	}
+	defer sockets.Close()
+	files, err := sockets.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.FileListener(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	m := &IdleMonitor{
+		Timeout:  time.Minute,
+		Activity: config.ServiceIdleActivityConnections,
+		sockets:  sockets,
+	}
+	start := time.Now()
+	m.Touch(start)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idle, err := m.Check(start.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idle {
+		t.Fatal("expected the open connection to keep the service from being idle")
+	}
+
+	conn.Close()
+	accepted.Close()
+	idle, err = m.Check(start.Add(2 * time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !idle {
+		t.Fatal("expected the service to be idle after the timeout")
+	}
+}
+
+// Connections are sampled by the checks, the ones opened and closed in
+// between don't count as activity.
+func TestIdleMonitorShortConnections(t *testing.T) {
+	sockets := &SocketActivation{
+		Sockets: []*ServiceSocket{
+			{Name: "http", Type: config.SocketTypeTcp, Address: "127.0.0.1:0"},
+		},
+	}
+	defer sockets.Close()
+	files, err := sockets.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.FileListener(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	m := &IdleMonitor{
+		Timeout:  time.Minute,
+		Activity: config.ServiceIdleActivityConnections,
+		sockets:  sockets,
+	}
+	start := time.Now()
+	m.Touch(start)
+
+	for range 3 {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		accepted, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		accepted.Close()
+	}
+
+	idle, err := m.Check(start.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !idle {
+		t.Fatal("expected connections shorter than the interval to go unnoticed")
+	}
+}
@@ -0,0 +1,111 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sync/atomic"
+)
+
+type LogFormatter interface {
+	Format(service string, line LogLine) string
+}
+
+type PlainLogFormatter struct{}
+
+func (this PlainLogFormatter) Format(service string, line LogLine) string {
+	switch line.Stream {
+	case LogStreamStdout:
+		return fmt.Sprintf("%s[stdout]: %s", service, line.Text)
+	case LogStreamStderr:
+		return fmt.Sprintf("%s[stderr]: %s", service, line.Text)
+	default:
+		return fmt.Sprintf("%s: %s", service, line.Text)
+	}
+}
+
+var _ LogFormatter = PlainLogFormatter{}
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[31m"
+)
+
+var logColors = []string{
+	"\x1b[36m", "\x1b[33m", "\x1b[32m", "\x1b[35m", "\x1b[34m",
+	"\x1b[96m", "\x1b[93m", "\x1b[92m", "\x1b[95m", "\x1b[94m",
+}
+
+// Formats lines the way foreman does, each service gets a stable color and
+// names are padded so the lines of all services are aligned.
+type ColorLogFormatter struct {
+	// Length of the longest name of the services, grows as services are
+	// added, e.g. instances and replicas.
+	width atomic.Int64
+}
+
+func (this *ColorLogFormatter) Format(service string, line LogLine) string {
+	name := fmt.Sprintf(
+		"%s%-*s%s", this.color(service), this.width.Load(), service, ansiReset,
+	)
+
+	switch line.Stream {
+	case LogStreamStdout:
+		return fmt.Sprintf("%s | %s", name, line.Text)
+	case LogStreamStderr:
+		return fmt.Sprintf("%s %s|%s %s", name, ansiRed, ansiReset, line.Text)
+	default:
+		return fmt.Sprintf(
+			"%s %s* %s%s", name, ansiBold, line.Text, ansiReset,
+		)
+	}
+}
+
+// Pads the names of the services to the name of the service as well.
+func (this *ColorLogFormatter) Add(service string) {
+	for {
+		width := this.width.Load()
+		if int64(len(service)) <= width ||
+			this.width.CompareAndSwap(width, int64(len(service))) {
+			return
+		}
+	}
+}
+
+func (this *ColorLogFormatter) color(service string) string {
+	h := fnv.New32a()
+	h.Write([]byte(service))
+	return logColors[h.Sum32()%uint32(len(logColors))]
+}
+
+var _ LogFormatter = (*ColorLogFormatter)(nil)
+
+func NewColorLogFormatter(services []string) *ColorLogFormatter {
+	f := &ColorLogFormatter{
+		width: atomic.Int64{},
+	}
+	for _, s := range services {
+		f.Add(s)
+	}
+
+	return f
+}
+
+// Colors are only used when writing to a terminal and NO_COLOR is not set,
+// see https://no-color.org.
+func ShouldColorize(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,93 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPlainLogFormatter(t *testing.T) {
+	f := PlainLogFormatter{}
+	tests := map[LogLine]string{
+		{LogStreamStdout, "out"}:   "web[stdout]: out",
+		{LogStreamStderr, "err"}:   "web[stderr]: err",
+		{LogStreamElla, "started"}: "web: started",
+	}
+	for line, expected := range tests {
+		if formatted := f.Format("web", line); formatted != expected {
+			t.Errorf("expected: %q received: %q", expected, formatted)
+		}
+	}
+}
+
+func TestColorLogFormatter(t *testing.T) {
+	f := NewColorLogFormatter([]string{"web", "worker", "db"})
+
+	color := f.color("web")
+	for range 3 {
+		if f.color("web") != color {
+			t.Fatal("expected a stable color for the same name")
+		}
+	}
+	if NewColorLogFormatter(nil).color("web") != color {
+		t.Fatal("expected the color not to depend on the other services")
+	}
+
+	tests := map[LogLine]string{
+		{LogStreamStdout, "out"}: color + "web   " + ansiReset + " | out",
+		{LogStreamStderr, "err"}: color + "web   " + ansiReset + " " +
+			ansiRed + "|" + ansiReset + " err",
+		{LogStreamElla, "started"}: color + "web   " + ansiReset + " " +
+			ansiBold + "* started" + ansiReset,
+	}
+	for line, expected := range tests {
+		if formatted := f.Format("web", line); formatted != expected {
+			t.Errorf("expected: %q received: %q", expected, formatted)
+		}
+	}
+
+	// The longest name isn't padded.
+	line := f.Format("worker", LogLine{LogStreamStdout, "out"})
+	if !strings.HasSuffix(line, "worker"+ansiReset+" | out") {
+		t.Errorf("unexpected line: %q", line)
+	}
+
+	f.Add("scheduler")
+	f.Add("db")
+	line = f.Format("web", LogLine{LogStreamStdout, "out"})
+	if !strings.Contains(line, "web      "+ansiReset) {
+		t.Errorf("expected the name to be padded to the added service: %q", line)
+	}
+}
+
+func TestShouldColorize(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	t.Setenv("NO_COLOR", "")
+	if ShouldColorize(w) {
+		t.Fatal("expected a pipe not to be colorized")
+	}
+
+	// Character devices are terminals as far as ella is concerned.
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+	if !ShouldColorize(null) {
+		t.Fatal("expected a character device to be colorized")
+	}
+
+	t.Setenv("NO_COLOR", "1")
+	if ShouldColorize(null) {
+		t.Fatal("expected NO_COLOR to disable colors")
+	}
+}
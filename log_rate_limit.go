@@ -0,0 +1,89 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/thekhanj/ella/config"
+)
+
+// Allows a burst of lines per interval, the same way journald does.
+type LogRateLimiter struct {
+	burst    int
+	interval time.Duration
+
+	mu         sync.Mutex
+	begin      time.Time
+	count      int
+	suppressed int
+}
+
+// Reports whether a line arriving at now may pass, along with the number of
+// lines suppressed in the previous interval when a new interval begins. The
+// first line suppressed in an interval gets the time the interval ends as
+// well, when the suppressed lines are to be reported by Flush in case no line
+// arrives by then.
+func (this *LogRateLimiter) Allow(now time.Time) (bool, int, time.Time) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	suppressed := 0
+	if now.Sub(this.begin) >= this.interval {
+		suppressed = this.suppressed
+		this.begin = now
+		this.count = 0
+		this.suppressed = 0
+	}
+
+	if this.count >= this.burst {
+		this.suppressed++
+		if this.suppressed == 1 {
+			return false, suppressed, this.begin.Add(this.interval)
+		}
+		return false, suppressed, time.Time{}
+	}
+
+	this.count++
+	return true, suppressed, time.Time{}
+}
+
+// Returns the number of lines suppressed in the interval once it has ended by
+// now, each suppressed line is reported once either by Flush or Allow.
+func (this *LogRateLimiter) Flush(now time.Time) int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if now.Sub(this.begin) < this.interval {
+		return 0
+	}
+	suppressed := this.suppressed
+	this.suppressed = 0
+
+	return suppressed
+}
+
+func NewLogRateLimiter(burst int, interval time.Duration) *LogRateLimiter {
+	return &LogRateLimiter{
+		burst:    burst,
+		interval: interval,
+
+		mu:         sync.Mutex{},
+		begin:      time.Time{},
+		count:      0,
+		suppressed: 0,
+	}
+}
+
+func NewLogRateLimiterFromConfig(
+	cfg *config.LogRateLimit,
+) (*LogRateLimiter, error) {
+	interval, err := time.ParseDuration(string(cfg.Interval))
+	if err != nil {
+		return nil, err
+	}
+
+	return NewLogRateLimiter(cfg.Burst, interval), nil
+}
@@ -0,0 +1,130 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+type LogRateLimiterTest struct {
+	t        *testing.T
+	burst    int
+	interval time.Duration
+	// Offsets of the lines from the beginning of the test.
+	lines []time.Duration
+	// Expected result of Allow for each line.
+	allowed []bool
+	// Expected suppressed count reported with each line.
+	suppressed []int
+	// Expected offsets the suppressed lines get flushed at, -1 when a line
+	// doesn't get one.
+	flushes []time.Duration
+}
+
+func (this *LogRateLimiterTest) Run() {
+	l := NewLogRateLimiter(this.burst, this.interval)
+	begin := time.Now()
+
+	for i, offset := range this.lines {
+		ok, suppressed, flushAt := l.Allow(begin.Add(offset))
+		if ok != this.allowed[i] {
+			this.t.Errorf(
+				"line %d: unexpected allowed: expected: %t received: %t",
+				i, this.allowed[i], ok,
+			)
+		}
+		if suppressed != this.suppressed[i] {
+			this.t.Errorf(
+				"line %d: unexpected suppressed: expected: %d received: %d",
+				i, this.suppressed[i], suppressed,
+			)
+		}
+		expected := time.Time{}
+		if this.flushes[i] >= 0 {
+			expected = begin.Add(this.flushes[i])
+		}
+		if !flushAt.Equal(expected) {
+			this.t.Errorf(
+				"line %d: unexpected flush: expected: %s received: %s",
+				i, expected, flushAt,
+			)
+		}
+	}
+}
+
+func TestLogRateLimiter(t *testing.T) {
+	lt := LogRateLimiterTest{
+		t, 2, time.Second,
+		[]time.Duration{
+			0, time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond,
+			time.Second, 1100 * time.Millisecond, 1200 * time.Millisecond,
+			3 * time.Second,
+		},
+		[]bool{true, true, false, false, true, true, false, true},
+		[]int{0, 0, 0, 0, 2, 0, 0, 1},
+		[]time.Duration{-1, -1, time.Second, -1, -1, -1, 2 * time.Second, -1},
+	}
+	lt.Run()
+}
+
+func TestLogRateLimiterFlush(t *testing.T) {
+	l := NewLogRateLimiter(1, time.Second)
+	begin := time.Now()
+
+	l.Allow(begin)
+	l.Allow(begin.Add(time.Millisecond))
+	l.Allow(begin.Add(2 * time.Millisecond))
+	if n := l.Flush(begin.Add(500 * time.Millisecond)); n != 0 {
+		t.Fatalf("expected nothing to be flushed within the interval, got %d", n)
+	}
+	if n := l.Flush(begin.Add(time.Second)); n != 2 {
+		t.Fatalf("expected 2 suppressed lines, got %d", n)
+	}
+	if n := l.Flush(begin.Add(time.Second)); n != 0 {
+		t.Fatalf("expected the lines to be flushed once, got %d", n)
+	}
+	if _, n, _ := l.Allow(begin.Add(1100 * time.Millisecond)); n != 0 {
+		t.Fatalf("expected the flushed lines not to be reported again, got %d", n)
+	}
+}
+
+func TestServiceLogRateLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := newTestService(
+		ctx, "for i in 1 2 3 4 5; do echo $i; done; exec sleep 10",
+		ServiceOptions{Limiter: NewLogRateLimiter(2, 200*time.Millisecond)},
+	)
+	logs := s.Logs()
+	defer logs.Close()
+
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	// The process doesn't write anything after its burst, the suppressed
+	// lines are reported once the interval ends regardless.
+	found := make(chan struct{})
+	go func() {
+		scanner := bufio.NewScanner(logs)
+		for scanner.Scan() {
+			if strings.Contains(scanner.Text(), "3 messages suppressed") {
+				close(found)
+				return
+			}
+		}
+	}()
+	select {
+	case <-found:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the suppressed lines to be reported")
+	}
+}
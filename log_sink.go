@@ -0,0 +1,192 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thekhanj/ella/config"
+)
+
+type LogStream int
+
+const (
+	LogStreamElla LogStream = iota
+	LogStreamStdout
+	LogStreamStderr
+)
+
+// Syslog severity of the lines coming from the stream.
+func (this LogStream) Severity() int {
+	switch this {
+	case LogStreamStdout:
+		return 6 // info
+	case LogStreamStderr:
+		return 3 // err
+	default:
+		return 5 // notice
+	}
+}
+
+type LogSink interface {
+	Send(identifier string, stream LogStream, line string) error
+	Close() error
+}
+
+func NewLogSinkFromConfig(cfg config.LogSink) (LogSink, error) {
+	if syslog, ok := cfg.(*config.SyslogLogSink); ok {
+		return NewSyslogLogSink(syslog.Address, syslog.Facility.GetCode()), nil
+	} else if journald, ok := cfg.(*config.JournaldLogSink); ok {
+		return NewJournaldLogSink(journald.Address), nil
+	} else {
+		return nil, fmt.Errorf("invalid log sink config: %v", cfg)
+	}
+}
+
+// Unix datagram connection which gets (re)established lazily, so a restarted
+// syslog daemon doesn't break the sink.
+type datagramConn struct {
+	address string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (this *datagramConn) write(b []byte) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	var err error
+	for retry := 0; retry < 2; retry++ {
+		if this.conn == nil {
+			this.conn, err = net.Dial("unixgram", this.address)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = this.conn.Write(b)
+		if err == nil {
+			return nil
+		}
+
+		this.conn.Close()
+		this.conn = nil
+	}
+
+	return err
+}
+
+func (this *datagramConn) Close() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.conn == nil {
+		return nil
+	}
+
+	err := this.conn.Close()
+	this.conn = nil
+	return err
+}
+
+type SyslogLogSink struct {
+	datagramConn
+
+	facility int
+	hostname string
+}
+
+func (this *SyslogLogSink) Send(
+	identifier string, stream LogStream, line string,
+) error {
+	// RFC 5424: <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG
+	msg := fmt.Sprintf(
+		"<%d>1 %s %s %s - - - %s",
+		this.facility*8+stream.Severity(),
+		time.Now().Format("2006-01-02T15:04:05.000000Z07:00"),
+		this.hostname, syslogAppName(identifier), line,
+	)
+
+	return this.write([]byte(msg))
+}
+
+func syslogAppName(identifier string) string {
+	name := strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, identifier)
+
+	if name == "" {
+		return "-"
+	}
+	if len(name) > 48 {
+		return name[:48]
+	}
+	return name
+}
+
+var _ LogSink = (*SyslogLogSink)(nil)
+
+func NewSyslogLogSink(address string, facility int) *SyslogLogSink {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	return &SyslogLogSink{
+		datagramConn: datagramConn{address: address},
+
+		facility: facility,
+		hostname: hostname,
+	}
+}
+
+type JournaldLogSink struct {
+	datagramConn
+}
+
+func (this *JournaldLogSink) Send(
+	identifier string, stream LogStream, line string,
+) error {
+	var b bytes.Buffer
+	writeJournaldField(&b, "MESSAGE", line)
+	writeJournaldField(&b, "PRIORITY", strconv.Itoa(stream.Severity()))
+	writeJournaldField(&b, "SYSLOG_IDENTIFIER", identifier)
+
+	return this.write(b.Bytes())
+}
+
+func writeJournaldField(b *bytes.Buffer, key, val string) {
+	if !strings.ContainsRune(val, '\n') {
+		fmt.Fprintf(b, "%s=%s\n", key, val)
+		return
+	}
+
+	// Values containing new lines are sent with an explicit little endian
+	// 64 bit size instead of the '=' separator.
+	b.WriteString(key)
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(val)))
+	b.WriteString(val)
+	b.WriteByte('\n')
+}
+
+var _ LogSink = (*JournaldLogSink)(nil)
+
+func NewJournaldLogSink(address string) *JournaldLogSink {
+	return &JournaldLogSink{
+		datagramConn: datagramConn{address: address},
+	}
+}
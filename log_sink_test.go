@@ -0,0 +1,145 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+type LogSinkTest struct {
+	t      *testing.T
+	create func(address string) LogSink
+	stream LogStream
+	line   string
+	assert func(datagram []byte)
+}
+
+func (this *LogSinkTest) Run() {
+	address := filepath.Join(this.t.TempDir(), "log.sock")
+	conn, err := net.ListenUnixgram(
+		"unixgram", &net.UnixAddr{Name: address, Net: "unixgram"},
+	)
+	if err != nil {
+		this.t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sink := this.create(address)
+	defer sink.Close()
+
+	err = sink.Send("service1", this.stream, this.line)
+	if err != nil {
+		this.t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		this.t.Fatal(err)
+	}
+
+	this.assert(buf[:n])
+}
+
+func TestSyslogLogSink(t *testing.T) {
+	lt := LogSinkTest{
+		t,
+		func(address string) LogSink {
+			// local0
+			return NewSyslogLogSink(address, 16)
+		},
+		LogStreamStderr,
+		"something went wrong",
+		func(datagram []byte) {
+			pattern := regexp.MustCompile(
+				`^<131>1 \S+ \S+ service1 - - - something went wrong$`,
+			)
+			if !pattern.Match(datagram) {
+				t.Errorf("unexpected syslog message: %q", datagram)
+			}
+		},
+	}
+	lt.Run()
+}
+
+func TestJournaldLogSink(t *testing.T) {
+	line := "first line\nsecond line"
+
+	var expected bytes.Buffer
+	expected.WriteString("MESSAGE\n")
+	binary.Write(&expected, binary.LittleEndian, uint64(len(line)))
+	expected.WriteString(line + "\n")
+	expected.WriteString("PRIORITY=6\n")
+	expected.WriteString("SYSLOG_IDENTIFIER=service1\n")
+
+	lt := LogSinkTest{
+		t,
+		func(address string) LogSink {
+			return NewJournaldLogSink(address)
+		},
+		LogStreamStdout,
+		line,
+		func(datagram []byte) {
+			if !bytes.Equal(datagram, expected.Bytes()) {
+				t.Errorf("unexpected journald message: %q", datagram)
+			}
+		},
+	}
+	lt.Run()
+}
+
+type chanLogSink chan LogLine
+
+func (this chanLogSink) Send(_ string, stream LogStream, line string) error {
+	select {
+	case this <- LogLine{stream, line}:
+	default:
+	}
+	return nil
+}
+
+func (this chanLogSink) Close() error {
+	return nil
+}
+
+func TestServiceLogSinksWithoutConsole(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sink := make(chanLogSink, 16)
+	s := newTestService(ctx, "echo out; echo err >&2; exec sleep 10",
+		ServiceOptions{Sinks: []LogSink{sink}},
+	)
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	// The outputs aren't echoed to the console, the sinks get them still.
+	expected := map[LogLine]bool{
+		{LogStreamStdout, "out"}: false,
+		{LogStreamStderr, "err"}: false,
+	}
+	timeout := time.After(2 * time.Second)
+	for received := 0; received < len(expected); {
+		select {
+		case line := <-sink:
+			if seen, ok := expected[line]; ok && !seen {
+				expected[line] = true
+				received++
+			}
+		case <-timeout:
+			t.Fatalf("expected the outputs to be sent to the sink: %v", expected)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// Longest partial line kept before it gets cut into a line of its own.
+const outputTailMaxLine = 4096
+
+// Keeps the last lines written into the standard outputs of a process.
+type OutputTail struct {
+	size int
+
+	mu      sync.Mutex
+	lines   []LogLine
+	partial map[LogStream]*bytes.Buffer
+}
+
+func (this *OutputTail) Lines() []LogLine {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	lines := make([]LogLine, len(this.lines))
+	copy(lines, this.lines)
+	return lines
+}
+
+func (this *OutputTail) Writer(stream LogStream) io.WriteCloser {
+	return &outputTailWriter{this, stream}
+}
+
+func (this *OutputTail) write(stream LogStream, p []byte) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	buf := this.partial[stream]
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			buf.Write(p)
+			if buf.Len() >= outputTailMaxLine {
+				this.push(stream, buf)
+			}
+			return
+		}
+
+		buf.Write(p[:i])
+		this.push(stream, buf)
+		p = p[i+1:]
+	}
+}
+
+func (this *OutputTail) flush(stream LogStream) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	buf := this.partial[stream]
+	if buf.Len() > 0 {
+		this.push(stream, buf)
+	}
+}
+
+func (this *OutputTail) push(stream LogStream, buf *bytes.Buffer) {
+	text := string(bytes.TrimRight(buf.Bytes(), "\r"))
+	buf.Reset()
+
+	this.lines = append(this.lines, LogLine{stream, text})
+	if len(this.lines) > this.size {
+		this.lines = this.lines[len(this.lines)-this.size:]
+	}
+}
+
+func NewOutputTail(size int) *OutputTail {
+	return &OutputTail{
+		size: size,
+
+		mu:    sync.Mutex{},
+		lines: make([]LogLine, 0, size),
+		partial: map[LogStream]*bytes.Buffer{
+			LogStreamStdout: {},
+			LogStreamStderr: {},
+		},
+	}
+}
+
+type outputTailWriter struct {
+	tail   *OutputTail
+	stream LogStream
+}
+
+func (this *outputTailWriter) Write(p []byte) (int, error) {
+	this.tail.write(this.stream, p)
+	return len(p), nil
+}
+
+func (this *outputTailWriter) Close() error {
+	this.tail.flush(this.stream)
+	return nil
+}
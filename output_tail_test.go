@@ -0,0 +1,92 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOutputTail(t *testing.T) {
+	tail := NewOutputTail(3)
+	stdout := tail.Writer(LogStreamStdout)
+	stderr := tail.Writer(LogStreamStderr)
+
+	stdout.Write([]byte("first\nsec"))
+	// Partial lines of the streams don't get mixed up.
+	stderr.Write([]byte("error\r\n"))
+	stdout.Write([]byte("ond\nthird\nfourth"))
+
+	expected := []LogLine{
+		{LogStreamStderr, "error"},
+		{LogStreamStdout, "second"},
+		{LogStreamStdout, "third"},
+	}
+	if lines := tail.Lines(); !slices.Equal(lines, expected) {
+		t.Fatalf("expected %v, got: %v", expected, lines)
+	}
+
+	// The partial line is kept once the output is closed.
+	stdout.Close()
+	stderr.Close()
+	expected = []LogLine{
+		{LogStreamStdout, "second"},
+		{LogStreamStdout, "third"},
+		{LogStreamStdout, "fourth"},
+	}
+	if lines := tail.Lines(); !slices.Equal(lines, expected) {
+		t.Fatalf("expected %v, got: %v", expected, lines)
+	}
+}
+
+func TestOutputTailLongLine(t *testing.T) {
+	tail := NewOutputTail(10)
+	w := tail.Writer(LogStreamStdout)
+
+	w.Write([]byte(strings.Repeat("x", outputTailMaxLine)))
+	w.Write([]byte("yy\n"))
+
+	lines := tail.Lines()
+	if len(lines) != 2 || len(lines[0].Text) != outputTailMaxLine ||
+		lines[1].Text != "yy" {
+		t.Fatalf("expected the long line to be cut, got %d lines", len(lines))
+	}
+}
+
+func TestProcGetTail(t *testing.T) {
+	p := NewProc("sh", "-c", "for i in 1 2 3 4; do echo out$i; done")
+	p.TailLines = 2
+	_, err := p.GetTail()
+	if err == nil {
+		t.Fatal("expected no tail before the process has run")
+	}
+	err = p.Run(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines, err := p.GetTail()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []LogLine{{LogStreamStdout, "out3"}, {LogStreamStdout, "out4"}}
+	if !slices.Equal(lines, expected) {
+		t.Fatalf("expected %v, got: %v", expected, lines)
+	}
+
+	p = NewProc("sh", "-c", "echo err >&2")
+	p.TailLines = 2
+	err = p.Run(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines, err = p.GetTail()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(lines, []LogLine{{LogStreamStderr, "err"}}) {
+		t.Fatalf("unexpected tail: %v", lines)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"sync"
 	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/cskr/pubsub/v2"
 	"github.com/google/shlex"
@@ -36,6 +37,8 @@ type ProcTopic int
 
 const procTopic ProcTopic = 0
 
+const procWaitDelay = time.Second
+
 var (
 	ProcErrNotStarted = errors.New("not started yet")
 	ProcErrNotStopped = errors.New("not stopped yet")
@@ -50,15 +53,43 @@ type Proc struct {
 	Cwd string
 	Uid uint32
 	Gid uint32
-	Env []string
+	// Supplementary groups, nil keeps the ones of the main process unless
+	// the credentials change.
+	Groups []uint32
+	Env    []string
+	// Called right before the process gets spawned, the variables it returns
+	// are added to Env, e.g. secrets which are read each time.
+	EnvFunc func() ([]string, error)
+	// Open files the process gets as file descriptors 3 and onwards.
+	ExtraFiles []*os.File
+
+	// Number of the last output lines to keep, see GetTail.
+	TailLines int
+	// Attributes applied right before executing the command, requires the
+	// ella binary to run the command through its exec helper.
+	Attr *ProcAttr
+	// Cgroup to spawn the process into, the processes left in it get killed
+	// once the process has exited.
+	Cgroup *Cgroup
+	// Directories created with the credentials of the process before it
+	// gets spawned.
+	Dirs []*ProcDir
 
 	state atomic.Int32
+	// Whether the cgroup and directories are shared with another process,
+	// they're left alone when the process exits.
+	shared atomic.Bool
+	// Transient directories created for the process, they're removed once no
+	// other process is using them.
+	acquired []*ProcDir
 
 	stdout *Broadcaster
 	stderr *Broadcaster
+	tail   *OutputTail
 
-	cmd      *exec.Cmd
-	exitCode atomic.Int32
+	cmd       *exec.Cmd
+	startedAt time.Time
+	exit      ProcExit
 
 	bus *pubsub.PubSub[ProcTopic, ProcState]
 }
@@ -71,18 +102,23 @@ func (this *Proc) Run(ctx context.Context) error {
 		return err
 	}
 
-	this.setCmd(ctx)
-	stdout, err := this.cmd.StdoutPipe()
-	if err != nil {
-		return err
+	if this.TailLines > 0 {
+		this.tail = NewOutputTail(this.TailLines)
+		this.stdout.Add(this.tail.Writer(LogStreamStdout))
+		this.stderr.Add(this.tail.Writer(LogStreamStderr))
 	}
-	stderr, err := this.cmd.StderrPipe()
+
+	err = this.setCmd(ctx)
 	if err != nil {
+		this.stdout.Close()
+		this.stderr.Close()
 		return err
 	}
-
-	err = this.cmd.Start()
+	flushed, err := this.start()
 	if err != nil {
+		this.releaseDirs()
+		this.stdout.Close()
+		this.stderr.Close()
 		return err
 	}
 
@@ -91,12 +127,10 @@ func (this *Proc) Run(ctx context.Context) error {
 		return err
 	}
 
-	err = this.wait(stdout, stderr)
-	if err != nil {
-		return err
-	}
+	this.waitForCmd()
+	flushed()
 
-	return nil
+	return this.setState(ProcStateWaitDone)
 }
 
 func (this *Proc) StdoutPipe() io.ReadCloser {
@@ -124,11 +158,33 @@ func (this *Proc) Signal(signal os.Signal) error {
 }
 
 func (this *Proc) GetExitCode() (int, error) {
+	exit, err := this.GetExit()
+	if err != nil {
+		return 0, err
+	}
+
+	return exit.Code, nil
+}
+
+func (this *Proc) GetExit() (ProcExit, error) {
 	if this.GetState() < ProcStateStopped {
-		return 0, ProcErrNotStopped
+		return ProcExit{}, ProcErrNotStopped
+	}
+
+	return this.exit, nil
+}
+
+// Returns the last lines the process has written into its standard outputs.
+func (this *Proc) GetTail() ([]LogLine, error) {
+	if this.GetState() < ProcStateWaitDone {
+		return nil, ProcErrNotStopped
 	}
 
-	return int(this.exitCode.Load()), nil
+	if this.tail == nil {
+		return []LogLine{}, nil
+	}
+
+	return this.tail.Lines(), nil
 }
 
 func (this *Proc) GetState() ProcState {
@@ -172,7 +228,7 @@ func (this *Proc) pipe(b *Broadcaster) io.ReadCloser {
 	return r
 }
 
-func (this *Proc) setCmd(ctx context.Context) {
+func (this *Proc) setCmd(ctx context.Context) error {
 	cmd := exec.CommandContext(ctx, this.Name, this.Args...)
 
 	if this.Cwd != "" {
@@ -181,61 +237,176 @@ func (this *Proc) setCmd(ctx context.Context) {
 	if this.Env != nil {
 		cmd.Env = this.Env
 	}
+	if this.EnvFunc != nil {
+		env, err := this.EnvFunc()
+		if err != nil {
+			return err
+		}
+		cmd.Env = append(cmd.Environ(), env...)
+	}
 	if this.Stdin != nil {
 		cmd.Stdin = this.Stdin
 	}
+	cmd.ExtraFiles = this.ExtraFiles
+
+	setCreds := this.Uid != uint32(syscall.Getuid()) ||
+		this.Gid != uint32(syscall.Getgid()) || this.Groups != nil
+	// Never leak the groups of the main process to another user.
+	groups := this.Groups
+	if groups == nil {
+		groups = []uint32{}
+	}
+
+	if this.Attr != nil && !this.Attr.IsEmpty() {
+		attr := *this.Attr
+		if setCreds {
+			attr.Uid = &this.Uid
+			attr.Gid = &this.Gid
+			attr.Groups = groups
+		}
 
-	if this.Uid != uint32(syscall.Getuid()) ||
-		this.Gid != uint32(syscall.Getgid()) {
+		err := attr.wrap(cmd)
+		if err != nil {
+			return err
+		}
+	} else if setCreds {
 		cmd.SysProcAttr = &syscall.SysProcAttr{
 			Credential: &syscall.Credential{
-				Uid: this.Uid,
-				Gid: this.Gid,
+				Uid:    this.Uid,
+				Gid:    this.Gid,
+				Groups: groups,
 			},
 		}
 	}
 
 	this.cmd = cmd
+	return nil
 }
 
-func (this *Proc) wait(stdout, stderr io.ReadCloser) error {
+// Starts the command with its outputs piped into the broadcasters, the
+// returned function waits for the outputs to be flushed.
+func (this *Proc) start() (func(), error) {
+	for _, dir := range this.Dirs {
+		err := dir.Create(this.Uid, this.Gid)
+		if err != nil {
+			return nil, fmt.Errorf("creating %s failed: %w", dir.FullPath(), err)
+		}
+		if dir.Transient {
+			dir.acquire()
+			this.acquired = append(this.acquired, dir)
+		}
+	}
+	if this.Cgroup != nil {
+		err := this.Cgroup.Create()
+		if err != nil {
+			return nil, err
+		}
+		detach, err := this.Cgroup.attach(this.cmd)
+		if err != nil {
+			return nil, err
+		}
+		defer detach()
+	}
+
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stderrR, stderrW, err := os.Pipe()
+	if err != nil {
+		stdoutR.Close()
+		stdoutW.Close()
+		return nil, err
+	}
+
+	this.cmd.Stdout = stdoutW
+	this.cmd.Stderr = stderrW
+	err = this.cmd.Start()
+	this.startedAt = time.Now()
+	stdoutW.Close()
+	stderrW.Close()
+	if err != nil {
+		stdoutR.Close()
+		stderrR.Close()
+		return nil, err
+	}
+
 	var wg sync.WaitGroup
 	// 1: stdout broadcaster
 	// 2: stderr broadcaster
-	// 3: command execution
-	wg.Add(3)
-
+	wg.Add(2)
 	go func() {
 		defer wg.Done()
 
-		this.flush(this.stdout, stdout)
+		this.stdout.Run(stdoutR)
 	}()
 	go func() {
 		defer wg.Done()
 
-		this.flush(this.stderr, stderr)
+		this.stderr.Run(stderrR)
 	}()
-	go func() {
-		defer wg.Done()
 
-		this.waitForCmd()
-	}()
+	return func() {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
 
-	wg.Wait()
-	return this.setState(ProcStateWaitDone)
+			wg.Wait()
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(procWaitDelay):
+			// Descendants of the process are holding the pipes open, don't
+			// wait for them forever.
+		}
+
+		stdoutR.Close()
+		stderrR.Close()
+		<-done
+	}, nil
 }
 
 func (this *Proc) waitForCmd() {
-	err := this.cmd.Wait()
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			this.exitCode.Store(int32(exitErr.ExitCode()))
+	// The exit status is taken from the process state, the error doesn't
+	// have anything more to say about it.
+	this.cmd.Wait()
+	if this.cmd.ProcessState != nil {
+		this.exit = NewProcExit(
+			this.cmd.ProcessState, this.startedAt, time.Now(),
+		)
+	}
+	if this.Cgroup != nil && !this.shared.Load() {
+		err := this.Cgroup.Remove()
+		if err != nil {
+			fmt.Println("proc:", err)
 		}
 	}
+	this.releaseDirs()
 
 	this.setState(ProcStateStopped)
 }
 
+func (this *Proc) releaseDirs() {
+	for _, dir := range this.acquired {
+		if !dir.release() || this.shared.Load() {
+			continue
+		}
+
+		err := dir.Remove()
+		if err != nil {
+			fmt.Println("proc:", err)
+		}
+	}
+	this.acquired = nil
+}
+
+// Marks the cgroup and directories of the process as shared with another
+// process running next to it, e.g. the one replacing it.
+func (this *Proc) Share(shared bool) {
+	this.shared.Store(shared)
+}
+
 func (this *Proc) setState(state ProcState) error {
 	curr := this.state.Load()
 	if curr >= int32(state) {
@@ -253,15 +424,6 @@ func (this *Proc) setState(state ProcState) error {
 	return nil
 }
 
-func (this *Proc) flush(b *Broadcaster, out io.ReadCloser) {
-	err := b.Run(out)
-	if err == os.ErrClosed {
-		return
-	}
-
-	out.Close()
-}
-
 func (this *Proc) checkBus() bool {
 	// The bus has already shutted down, so adding another cmd into it's
 	// cmd channel would block the program.
@@ -274,17 +436,26 @@ func (this *Proc) checkBus() bool {
 
 func NewProc(name string, args ...string) *Proc {
 	return &Proc{
-		Name:  name,
-		Args:  args,
-		Stdin: nil,
-		Cwd:   "",
-		Uid:   uint32(syscall.Getuid()),
-		Gid:   uint32(syscall.Getgid()),
-		Env:   nil,
-
-		state:  atomic.Int32{},
-		stdout: NewBroadcaster(),
-		stderr: NewBroadcaster(),
+		Name:   name,
+		Args:   args,
+		Stdin:  nil,
+		Cwd:    "",
+		Uid:    uint32(syscall.Getuid()),
+		Gid:    uint32(syscall.Getgid()),
+		Groups: nil,
+		Env:    nil,
+
+		EnvFunc:   nil,
+		TailLines: 0,
+		Attr:      nil,
+		Cgroup:    nil,
+		Dirs:      nil,
+
+		state:    atomic.Int32{},
+		shared:   atomic.Bool{},
+		acquired: nil,
+		stdout:   NewBroadcaster(),
+		stderr:   NewBroadcaster(),
 
 		bus: pubsub.New[ProcTopic, ProcState](0),
 	}
@@ -4,8 +4,11 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -62,8 +65,12 @@ func (this *StopSignalProcAction) Exec(proc *Proc) error {
 	}
 }
 
-func NewStopProcActionFromConfig(cfg config.StopProcAction) (ProcAction, error) {
-	if stop, ok := cfg.(*config.StopSignalProcAction); ok {
+func NewStopProcActionFromConfig(
+	cfg config.StopProcAction, createProc CreateProc, vars config.Vars,
+) (ProcAction, error) {
+	if exec, ok := cfg.(*config.ProcActionExec); ok {
+		return NewExecProcActionFromConfig(exec, createProc, vars, true)
+	} else if stop, ok := cfg.(*config.StopSignalProcAction); ok {
 		timeout, err := time.ParseDuration(string(stop.Timeout))
 		if err != nil {
 			return nil, err
@@ -97,8 +104,12 @@ func (this *ReloadSignalProcAction) Exec(proc *Proc) error {
 	return process.Signal(this.signal)
 }
 
-func NewReloadProcActionFromConfig(cfg config.ReloadProcAction) (ProcAction, error) {
-	if signal, ok := cfg.(config.ProcActionSignalCode); ok {
+func NewReloadProcActionFromConfig(
+	cfg config.ReloadProcAction, createProc CreateProc, vars config.Vars,
+) (ProcAction, error) {
+	if exec, ok := cfg.(*config.ProcActionExec); ok {
+		return NewExecProcActionFromConfig(exec, createProc, vars, false)
+	} else if signal, ok := cfg.(config.ProcActionSignalCode); ok {
 		return &ReloadSignalProcAction{
 			signal: signal.GetSignal(),
 		}, nil
@@ -108,3 +119,123 @@ func NewReloadProcActionFromConfig(cfg config.ReloadProcAction) (ProcAction, err
 }
 
 var _ (ProcAction) = (*ReloadSignalProcAction)(nil)
+
+// Executes a command for the process, e.g. its control utility.
+type ExecProcAction struct {
+	createProc CreateProc
+	// Arguments of the command, interpolated once MAINPID is known.
+	args    []string
+	vars    config.Vars
+	timeout time.Duration
+	// Waits for the process to stop after the command has exited, the
+	// process gets killed once the timeout is reached.
+	stop bool
+}
+
+func (this *ExecProcAction) Exec(proc *Proc) error {
+	process, err := proc.GetProcess()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+
+	stopped := make(chan struct{})
+	if this.stop {
+		states := proc.Sub()
+		go func() {
+			defer close(stopped)
+
+			common.WaitFor(
+				states, func() { proc.Unsub(states) },
+				ProcStateStopped,
+			)
+		}()
+	}
+
+	err = this.run(ctx, proc, process.Pid)
+	if !this.stop {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		killErr := process.Kill()
+		if killErr != nil {
+			return killErr
+		}
+
+		<-stopped
+	case <-stopped:
+	}
+
+	return err
+}
+
+func (this *ExecProcAction) run(ctx context.Context, proc *Proc, pid int) error {
+	args, err := config.InterpolateAll(
+		this.args, this.vars.With("MAINPID", strconv.Itoa(pid)),
+	)
+	if err != nil {
+		return err
+	}
+
+	action := this.createProc(args[0], args[1:]...)
+	// Outputs of the command are a part of the outputs of the process.
+	action.stdout.Add(nopWriteCloser{proc.stdout})
+	action.stderr.Add(nopWriteCloser{proc.stderr})
+
+	err = action.Run(ctx)
+	if err != nil {
+		return err
+	}
+
+	exit, err := action.GetExit()
+	if err != nil {
+		return err
+	}
+	if exit.Signaled() || exit.Code != 0 {
+		return fmt.Errorf("%s %s", args[0], exit.String())
+	}
+
+	return nil
+}
+
+// Interpolates the command with a placeholder pid, so undefined variables
+// are reported while loading the config.
+func NewExecProcActionFromConfig(
+	cfg *config.ProcActionExec, createProc CreateProc, vars config.Vars,
+	stop bool,
+) (ProcAction, error) {
+	args, err := ParseCommandLine(string(cfg.Exec))
+	if err != nil {
+		return nil, err
+	}
+	_, err = config.InterpolateAll(args, vars.With("MAINPID", "0"))
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := time.ParseDuration(string(cfg.Timeout))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExecProcAction{
+		createProc: createProc,
+		args:       args,
+		vars:       vars,
+		timeout:    timeout,
+		stop:       stop,
+	}, nil
+}
+
+var _ (ProcAction) = (*ExecProcAction)(nil)
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (this nopWriteCloser) Close() error {
+	return nil
+}
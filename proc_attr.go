@@ -0,0 +1,305 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"syscall"
+
+	"github.com/thekhanj/ella/config"
+)
+
+// Hidden command ella re-executes itself with to apply a ProcAttr.
+const procAttrHelperCmd = "__exec"
+
+// Exit code of the helper when it fails to prepare or execute the command,
+// the same as a shell's when a command can't be executed.
+const procAttrHelperFailed = 126
+
+const (
+	ioClassNone = iota
+	ioClassRealtime
+	ioClassBestEffort
+	ioClassIdle
+)
+
+// Attributes of a process which have to be applied between fork and exec,
+// which Go doesn't allow. So ella re-executes itself as a helper, applies
+// them to itself and then executes the actual command.
+type ProcAttr struct {
+	Limits         []config.ResourceLimit `json:"limits,omitempty"`
+	Nice           *int                   `json:"nice,omitempty"`
+	IoClass        int                    `json:"ioClass,omitempty"`
+	IoPriority     int                    `json:"ioPriority,omitempty"`
+	OomScoreAdjust *int                   `json:"oomScoreAdjust,omitempty"`
+	CpuAffinity    []int                  `json:"cpuAffinity,omitempty"`
+	Umask          *int                   `json:"umask,omitempty"`
+
+	NoNewPrivileges bool `json:"noNewPrivileges,omitempty"`
+	// Nil keeps the bounding set, empty drops every capability.
+	CapabilityBoundingSet *[]int   `json:"capabilityBoundingSet,omitempty"`
+	AmbientCapabilities   []int    `json:"ambientCapabilities,omitempty"`
+	PrivateTmp            bool     `json:"privateTmp,omitempty"`
+	ReadOnlyPaths         []string `json:"readOnlyPaths,omitempty"`
+	InaccessiblePaths     []string `json:"inaccessiblePaths,omitempty"`
+	PrivateNetwork        bool     `json:"privateNetwork,omitempty"`
+	RootDirectory         string   `json:"rootDirectory,omitempty"`
+
+	// Sets LISTEN_PID to the pid of the process, which isn't known before
+	// it gets spawned.
+	ListenPid bool `json:"listenPid,omitempty"`
+
+	// Credentials are changed last, raising limits or lowering the nice
+	// value requires the privileges of the daemon.
+	Uid *uint32 `json:"uid,omitempty"`
+	Gid *uint32 `json:"gid,omitempty"`
+	// Empty drops the supplementary groups of the daemon, which omitting it
+	// wouldn't.
+	Groups []uint32 `json:"groups"`
+}
+
+func (this *ProcAttr) IsEmpty() bool {
+	return len(this.Limits) == 0 && this.Nice == nil &&
+		this.IoClass == ioClassNone && this.OomScoreAdjust == nil &&
+		this.CpuAffinity == nil && this.Umask == nil &&
+		!this.NoNewPrivileges && this.CapabilityBoundingSet == nil &&
+		this.AmbientCapabilities == nil && !this.PrivateTmp &&
+		this.ReadOnlyPaths == nil && this.InaccessiblePaths == nil &&
+		!this.PrivateNetwork && this.RootDirectory == "" && !this.ListenPid
+}
+
+// Makes the command get executed by the helper.
+func (this *ProcAttr) wrap(cmd *exec.Cmd) error {
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+
+	b, err := json.Marshal(this)
+	if err != nil {
+		return err
+	}
+	self, err := selfExecutable()
+	if err != nil {
+		return err
+	}
+
+	args := []string{"ella", procAttrHelperCmd, string(b), cmd.Path}
+	cmd.Args = append(args, cmd.Args...)
+	cmd.Path = self
+	this.setSysProcAttr(cmd)
+
+	return nil
+}
+
+func (this *ProcAttr) apply() error {
+	for _, limit := range this.Limits {
+		resource, ok := rlimitResources[limit.Name]
+		if !ok {
+			return fmt.Errorf("%s limit is not supported", limit.Name)
+		}
+
+		var rlimit syscall.Rlimit
+		setRlimitValue(&rlimit.Cur, limit.Soft)
+		setRlimitValue(&rlimit.Max, limit.Hard)
+		err := syscall.Setrlimit(resource, &rlimit)
+		if err != nil {
+			return fmt.Errorf("setting %s limit failed: %w", limit.Name, err)
+		}
+	}
+
+	if this.Nice != nil {
+		err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, *this.Nice)
+		if err != nil {
+			return fmt.Errorf("setting nice failed: %w", err)
+		}
+	}
+
+	err := this.applyPlatform()
+	if err != nil {
+		return err
+	}
+
+	if this.Umask != nil {
+		syscall.Umask(*this.Umask)
+	}
+
+	err = this.applySandbox()
+	if err != nil {
+		return err
+	}
+
+	if this.Groups != nil {
+		groups := make([]int, 0)
+		for _, g := range this.Groups {
+			groups = append(groups, int(g))
+		}
+		err := syscall.Setgroups(groups)
+		if err != nil {
+			return fmt.Errorf("setting supplementary groups failed: %w", err)
+		}
+	}
+	if this.Gid != nil {
+		err := syscall.Setgid(int(*this.Gid))
+		if err != nil {
+			return fmt.Errorf("setting gid failed: %w", err)
+		}
+	}
+	if this.Uid != nil {
+		err := syscall.Setuid(int(*this.Uid))
+		if err != nil {
+			return fmt.Errorf("setting uid failed: %w", err)
+		}
+	}
+
+	return this.applyPrivileges()
+}
+
+// Fields of syscall.Rlimit are signed on some BSDs.
+func setRlimitValue[T int64 | uint64](field *T, v uint64) {
+	if v == config.LimitInfinity {
+		v = rlimInfinity
+	}
+
+	*field = T(v)
+}
+
+// Runs the helper, args are the encoded attributes, path of the command
+// and its arguments.
+func RunProcAttrHelper(args []string) int {
+	// Nice, io priority and cpu affinity are per thread, they have to be
+	// applied by the thread executing the command.
+	runtime.LockOSThread()
+
+	if len(args) < 3 {
+		fmt.Fprintln(os.Stderr, "ella: not enough arguments")
+		return procAttrHelperFailed
+	}
+
+	var attr ProcAttr
+	err := json.Unmarshal([]byte(args[0]), &attr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ella: invalid process attributes:", err)
+		return procAttrHelperFailed
+	}
+
+	err = attr.apply()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ella:", err)
+		return procAttrHelperFailed
+	}
+
+	env := os.Environ()
+	if attr.ListenPid {
+		env = append(env, fmt.Sprintf("LISTEN_PID=%d", os.Getpid()))
+	}
+
+	err = syscall.Exec(args[1], args[2:], env)
+	fmt.Fprintf(os.Stderr, "ella: executing %s failed: %s\n", args[1], err)
+	return procAttrHelperFailed
+}
+
+func NewProcAttrFromConfig(cfg *config.Proc) (*ProcAttr, error) {
+	limits, err := cfg.GetLimits()
+	if err != nil {
+		return nil, err
+	}
+	cpus, err := cfg.GetCpuAffinity()
+	if err != nil {
+		return nil, err
+	}
+	umask, err := cfg.GetUmask()
+	if err != nil {
+		return nil, err
+	}
+	var ambient []int = nil
+	if len(cfg.AmbientCapabilities) != 0 {
+		ambient, err = parseCapabilities(cfg.AmbientCapabilities)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var bounding *[]int = nil
+	if cfg.CapabilityBoundingSet != nil {
+		caps, err := parseCapabilities(cfg.CapabilityBoundingSet)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range ambient {
+			if !slices.Contains(caps, c) {
+				return nil, errors.New(
+					"ambient capabilities have to be in the capability bounding set",
+				)
+			}
+		}
+		bounding = &caps
+	}
+	rootDirectory := ""
+	if cfg.RootDirectory != nil {
+		rootDirectory = *cfg.RootDirectory
+	}
+
+	attr := &ProcAttr{
+		Limits:         limits,
+		Nice:           cfg.Nice,
+		IoClass:        ioClassNone,
+		IoPriority:     4,
+		OomScoreAdjust: cfg.OomScoreAdjust,
+		CpuAffinity:    cpus,
+		Umask:          umask,
+
+		NoNewPrivileges:       cfg.NoNewPrivileges,
+		CapabilityBoundingSet: bounding,
+		AmbientCapabilities:   ambient,
+		PrivateTmp:            cfg.PrivateTmp,
+		ReadOnlyPaths:         cfg.ReadOnlyPaths,
+		InaccessiblePaths:     cfg.InaccessiblePaths,
+		PrivateNetwork:        cfg.PrivateNetwork,
+		RootDirectory:         rootDirectory,
+
+		ListenPid: false,
+
+		Uid:    nil,
+		Gid:    nil,
+		Groups: nil,
+	}
+
+	if cfg.IoSchedulingClass != nil {
+		switch *cfg.IoSchedulingClass {
+		case config.ProcIoSchedulingClassRealtime:
+			attr.IoClass = ioClassRealtime
+		case config.ProcIoSchedulingClassBestEffort:
+			attr.IoClass = ioClassBestEffort
+		case config.ProcIoSchedulingClassIdle:
+			attr.IoClass = ioClassIdle
+		}
+	}
+	if cfg.IoSchedulingPriority != nil {
+		if attr.IoClass == ioClassNone {
+			return nil, fmt.Errorf("ioSchedulingPriority requires ioSchedulingClass")
+		}
+		attr.IoPriority = *cfg.IoSchedulingPriority
+	}
+
+	return attr, nil
+}
+
+// Returns an empty slice for no capabilities, never nil.
+func parseCapabilities(names []config.Capability) ([]int, error) {
+	caps := make([]int, 0)
+	for _, name := range names {
+		c, err := parseCapability(string(name))
+		if err != nil {
+			return nil, err
+		}
+		caps = append(caps, c)
+	}
+
+	return caps, nil
+}
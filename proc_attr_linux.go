@@ -0,0 +1,78 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var rlimitResources = map[string]int{
+	"nofile":  syscall.RLIMIT_NOFILE,
+	"nproc":   6,
+	"core":    syscall.RLIMIT_CORE,
+	"memlock": 8,
+	"stack":   syscall.RLIMIT_STACK,
+	"as":      syscall.RLIMIT_AS,
+}
+
+const rlimInfinity uint64 = ^uint64(0)
+
+// See ioprio_set(2).
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+)
+
+func (this *ProcAttr) applyPlatform() error {
+	if this.IoClass != ioClassNone {
+		prio := this.IoClass<<ioprioClassShift | this.IoPriority
+		_, _, errno := syscall.Syscall(
+			syscall.SYS_IOPRIO_SET, ioprioWhoProcess, 0, uintptr(prio),
+		)
+		if errno != 0 {
+			return fmt.Errorf("setting io scheduling failed: %w", errno)
+		}
+	}
+
+	if this.OomScoreAdjust != nil {
+		err := os.WriteFile(
+			"/proc/self/oom_score_adj",
+			[]byte(fmt.Sprint(*this.OomScoreAdjust)), 0644,
+		)
+		if err != nil {
+			return fmt.Errorf("setting oom score adjust failed: %w", err)
+		}
+	}
+
+	if this.CpuAffinity != nil {
+		var mask [1024 / 64]uint64
+		for _, cpu := range this.CpuAffinity {
+			if cpu >= len(mask)*64 {
+				return fmt.Errorf("invalid cpu: %d", cpu)
+			}
+			mask[cpu/64] |= 1 << (cpu % 64)
+		}
+
+		_, _, errno := syscall.RawSyscall(
+			syscall.SYS_SCHED_SETAFFINITY, 0,
+			unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask)),
+		)
+		if errno != 0 {
+			return fmt.Errorf("setting cpu affinity failed: %w", errno)
+		}
+	}
+
+	return nil
+}
+
+// The binary might get replaced by an upgrade while the daemon is running,
+// /proc/self/exe keeps pointing to the running one.
+func selfExecutable() (string, error) {
+	return "/proc/self/exe", nil
+}
@@ -0,0 +1,42 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// Values of nproc and memlock are the same on darwin and the BSDs, the
+// address space limit isn't available on all of them.
+var rlimitResources = map[string]int{
+	"nofile":  syscall.RLIMIT_NOFILE,
+	"nproc":   7,
+	"core":    syscall.RLIMIT_CORE,
+	"memlock": 6,
+	"stack":   syscall.RLIMIT_STACK,
+}
+
+const rlimInfinity uint64 = 1<<63 - 1
+
+func (this *ProcAttr) applyPlatform() error {
+	if this.IoClass != ioClassNone {
+		return errors.New("io scheduling is only supported on linux")
+	}
+	if this.OomScoreAdjust != nil {
+		return errors.New("oom score adjust is only supported on linux")
+	}
+	if this.CpuAffinity != nil {
+		return errors.New("cpu affinity is only supported on linux")
+	}
+
+	return nil
+}
+
+func selfExecutable() (string, error) {
+	return os.Executable()
+}
@@ -0,0 +1,95 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Runs the process and returns its standard output.
+func runProcOutput(t *testing.T, p *Proc) string {
+	t.Helper()
+
+	stdout := p.StdoutPipe()
+	defer stdout.Close()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		err := p.Run(ctx)
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+
+	b, err := io.ReadAll(stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	return string(b)
+}
+
+func roundTripProcAttr(t *testing.T, attr *ProcAttr) ProcAttr {
+	t.Helper()
+
+	b, err := json.Marshal(attr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ret ProcAttr
+	err = json.Unmarshal(b, &ret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ret
+}
+
+func TestProcAttrJSONGroups(t *testing.T) {
+	attr := roundTripProcAttr(t, &ProcAttr{Groups: []uint32{}})
+	if attr.Groups == nil || len(attr.Groups) != 0 {
+		t.Fatalf("expected no supplementary groups, got: %v", attr.Groups)
+	}
+
+	attr = roundTripProcAttr(t, &ProcAttr{Groups: nil})
+	if attr.Groups != nil {
+		t.Fatalf("expected the groups to be kept, got: %v", attr.Groups)
+	}
+
+	attr = roundTripProcAttr(t, &ProcAttr{Groups: []uint32{10, 20}})
+	if len(attr.Groups) != 2 || attr.Groups[0] != 10 || attr.Groups[1] != 20 {
+		t.Fatalf("unexpected groups: %v", attr.Groups)
+	}
+}
+
+func TestProcAttrDropsGroups(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing credentials requires root")
+	}
+
+	umask := 0022
+	p := NewProc("/usr/bin/sh", "-c", "grep ^Groups: /proc/self/status")
+	p.Uid = 65534
+	p.Gid = 65534
+	p.Groups = []uint32{}
+	// Makes the process get executed by the helper.
+	p.Attr = &ProcAttr{Umask: &umask}
+
+	out := strings.Fields(runProcOutput(t, p))
+	if len(out) != 1 {
+		t.Fatalf("expected no supplementary groups, got: %v", out)
+	}
+}
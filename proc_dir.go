@@ -0,0 +1,140 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/thekhanj/ella/common"
+	"github.com/thekhanj/ella/config"
+)
+
+// A directory created for a process right before spawning it, e.g. the
+// runtime directory of a service.
+type ProcDir struct {
+	// Directory the path is relative to, it's owned by the daemon.
+	Base string
+	Path string
+	// Environment variable the full path is exported as.
+	Env  string
+	Mode os.FileMode
+	// Removes the directory once the process has exited.
+	Transient bool
+}
+
+// Number of the processes using each transient directory by its full path,
+// e.g. the replicas of a service or the instances of a template share their
+// runtime directory.
+var procDirUsers = struct {
+	sync.Mutex
+	counts map[string]int
+}{counts: make(map[string]int)}
+
+func (this *ProcDir) FullPath() string {
+	return filepath.Join(this.Base, this.Path)
+}
+
+// Creates the directory and the missing parents within the base directory,
+// all of them owned by uid and gid. Symlinks are refused, as the process
+// owning the directories could otherwise redirect the ownership change to
+// any path.
+func (this *ProcDir) Create(uid, gid uint32) error {
+	err := os.MkdirAll(this.Base, 0755)
+	if err != nil {
+		return err
+	}
+
+	return createOwnedDirs(
+		this.Base, strings.Split(this.Path, string(filepath.Separator)),
+		uid, gid, this.Mode,
+	)
+}
+
+// Marks the directory as used by another process.
+func (this *ProcDir) acquire() {
+	procDirUsers.Lock()
+	defer procDirUsers.Unlock()
+
+	procDirUsers.counts[this.FullPath()]++
+}
+
+// Marks the directory as unused by a process, reporting whether no other
+// process is using it.
+func (this *ProcDir) release() bool {
+	procDirUsers.Lock()
+	defer procDirUsers.Unlock()
+
+	path := this.FullPath()
+	procDirUsers.counts[path]--
+	if procDirUsers.counts[path] > 0 {
+		return false
+	}
+
+	delete(procDirUsers.counts, path)
+	return true
+}
+
+func (this *ProcDir) Remove() error {
+	return os.RemoveAll(this.FullPath())
+}
+
+func (this *ProcDir) EnvVar() string {
+	return fmt.Sprintf("%s=%s", this.Env, this.FullPath())
+}
+
+func NewProcDirsFromConfig(cfg *config.Proc) ([]*ProcDir, error) {
+	mode, err := cfg.GetDirectoryMode()
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := make([]*ProcDir, 0)
+	add := func(
+		path *config.ServiceDirectory, base, env string, transient bool,
+	) error {
+		if path == nil {
+			return nil
+		}
+
+		clean := filepath.Clean(string(*path))
+		if filepath.IsAbs(clean) || clean == "." || clean == ".." ||
+			strings.HasPrefix(clean, "../") {
+			return fmt.Errorf("invalid directory: %s", *path)
+		}
+
+		dirs = append(dirs, &ProcDir{
+			Base:      base,
+			Path:      clean,
+			Env:       env,
+			Mode:      mode,
+			Transient: transient,
+		})
+		return nil
+	}
+
+	err = add(
+		cfg.RuntimeDirectory, common.GetRuntimeDir(), "RUNTIME_DIRECTORY", true,
+	)
+	if err != nil {
+		return nil, err
+	}
+	err = add(cfg.StateDirectory, common.GetStateDir(), "STATE_DIRECTORY", false)
+	if err != nil {
+		return nil, err
+	}
+	err = add(cfg.CacheDirectory, common.GetCacheDir(), "CACHE_DIRECTORY", false)
+	if err != nil {
+		return nil, err
+	}
+	err = add(cfg.LogsDirectory, common.GetLogsDir(), "LOGS_DIRECTORY", false)
+	if err != nil {
+		return nil, err
+	}
+
+	return dirs, nil
+}
@@ -0,0 +1,66 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Each directory is created and opened relative to its parent, so none of
+// the components can be swapped for a symlink in between.
+func createOwnedDirs(
+	base string, parts []string, uid, gid uint32, mode os.FileMode,
+) error {
+	fd, err := syscall.Open(
+		base, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0,
+	)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: base, Err: err}
+	}
+	defer func() {
+		syscall.Close(fd)
+	}()
+
+	path := base
+	for _, part := range parts {
+		path = filepath.Join(path, part)
+
+		err := syscall.Mkdirat(fd, part, uint32(mode.Perm()))
+		if err != nil && !errors.Is(err, syscall.EEXIST) {
+			return &os.PathError{Op: "mkdir", Path: path, Err: err}
+		}
+		next, err := syscall.Openat(
+			fd, part,
+			syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_NOFOLLOW|
+				syscall.O_CLOEXEC,
+			0,
+		)
+		if errors.Is(err, syscall.ELOOP) {
+			return fmt.Errorf("%s is a symlink", path)
+		}
+		if err != nil {
+			return &os.PathError{Op: "open", Path: path, Err: err}
+		}
+		syscall.Close(fd)
+		fd = next
+
+		err = syscall.Fchown(fd, int(uid), int(gid))
+		if err != nil {
+			return &os.PathError{Op: "chown", Path: path, Err: err}
+		}
+		// Mkdirat is affected by the umask of the daemon.
+		err = syscall.Fchmod(fd, uint32(mode.Perm()))
+		if err != nil {
+			return &os.PathError{Op: "chmod", Path: path, Err: err}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Without openat the components are only checked right before changing
+// their owner, which is racy.
+func createOwnedDirs(
+	base string, parts []string, uid, gid uint32, mode os.FileMode,
+) error {
+	path := base
+	for _, part := range parts {
+		path = filepath.Join(path, part)
+
+		err := os.Mkdir(path, mode)
+		if err != nil && !errors.Is(err, os.ErrExist) {
+			return err
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s is a symlink", path)
+		}
+		err = os.Lchown(path, int(uid), int(gid))
+		if err != nil {
+			return err
+		}
+		// Mkdir is affected by the umask of the daemon.
+		err = os.Chmod(path, mode)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
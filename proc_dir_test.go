@@ -0,0 +1,127 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/thekhanj/ella/config"
+)
+
+func TestProcDir(t *testing.T) {
+	dir := &ProcDir{
+		Base:      filepath.Join(t.TempDir(), "run"),
+		Path:      "app/sockets",
+		Env:       "RUNTIME_DIRECTORY",
+		Mode:      0750,
+		Transient: true,
+	}
+
+	err := dir.Create(uint32(syscall.Getuid()), uint32(syscall.Getgid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"app", "app/sockets"} {
+		info, err := os.Stat(filepath.Join(dir.Base, p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0750 {
+			t.Errorf("unexpected mode of %s: %s", p, info.Mode().Perm())
+		}
+	}
+
+	// Existing directories are fine.
+	err = dir.Create(uint32(syscall.Getuid()), uint32(syscall.Getgid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dir.Remove()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(dir.FullPath())
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the directory to be removed: %v", err)
+	}
+}
+
+func TestProcDirRefusesSymlinks(t *testing.T) {
+	target := t.TempDir()
+	err := os.Chmod(target, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := &ProcDir{
+		Base: filepath.Join(t.TempDir(), "state"),
+		Path: "app/data",
+		Env:  "STATE_DIRECTORY",
+		Mode: 0750,
+	}
+	err = os.MkdirAll(filepath.Join(dir.Base, "app"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Planted by a process owning the directory of the previous run.
+	err = os.Symlink(target, filepath.Join(dir.Base, "app/data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dir.Create(uint32(syscall.Getuid()), uint32(syscall.Getgid()))
+	if err == nil {
+		t.Fatal("expected a symlinked directory to be refused")
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("expected the target to be untouched, got: %s", info.Mode().Perm())
+	}
+
+	err = os.Remove(filepath.Join(dir.Base, "app/data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(target, filepath.Join(dir.Base, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir.Path = "link/data"
+	err = dir.Create(uint32(syscall.Getuid()), uint32(syscall.Getgid()))
+	if err == nil {
+		t.Fatal("expected a symlinked parent to be refused")
+	}
+	_, err = os.Stat(filepath.Join(target, "data"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected nothing to be created in the target: %v", err)
+	}
+}
+
+func TestProcDirsFromConfig(t *testing.T) {
+	for _, path := range []string{"/abs", "..", "../up", "."} {
+		dir := config.ServiceDirectory(path)
+		_, err := NewProcDirsFromConfig(&config.Proc{RuntimeDirectory: &dir})
+		if err == nil {
+			t.Errorf("expected an error for %s", path)
+		}
+	}
+
+	dir := config.ServiceDirectory("app/./data/")
+	dirs, err := NewProcDirsFromConfig(&config.Proc{StateDirectory: &dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) != 1 || dirs[0].Path != "app/data" || dirs[0].Transient ||
+		dirs[0].Mode != 0755 {
+		t.Errorf("unexpected directories: %+v", dirs[0])
+	}
+}
@@ -0,0 +1,146 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// How a process has terminated along with its resource usage.
+type ProcExit struct {
+	Pid int
+	// Exit code of the process, -1 when it was terminated by a signal.
+	Code int
+	// Signal terminating the process, zero when it exited by itself.
+	Signal     syscall.Signal
+	CoreDumped bool
+
+	// Maximum resident set size in bytes.
+	MaxRSS     int64
+	UserTime   time.Duration
+	SystemTime time.Duration
+
+	StartedAt time.Time
+	StoppedAt time.Time
+}
+
+func (this *ProcExit) Signaled() bool {
+	return this.Signal != 0
+}
+
+func (this *ProcExit) Runtime() time.Duration {
+	return this.StoppedAt.Sub(this.StartedAt)
+}
+
+func (this *ProcExit) String() string {
+	if !this.Signaled() {
+		return fmt.Sprintf("exited with code %d", this.Code)
+	}
+
+	ret := fmt.Sprintf("killed by signal %s", SignalName(this.Signal))
+	if this.CoreDumped {
+		ret += " (core dumped)"
+	}
+	return ret
+}
+
+func (this *ProcExit) Usage() string {
+	return fmt.Sprintf(
+		"ran %s, max rss %.1fMiB, user %s, system %s",
+		this.Runtime().Round(time.Millisecond),
+		float64(this.MaxRSS)/(1<<20),
+		this.UserTime.Round(time.Millisecond),
+		this.SystemTime.Round(time.Millisecond),
+	)
+}
+
+func NewProcExit(
+	state *os.ProcessState, startedAt, stoppedAt time.Time,
+) ProcExit {
+	exit := ProcExit{
+		Pid:       state.Pid(),
+		Code:      state.ExitCode(),
+		StartedAt: startedAt,
+		StoppedAt: stoppedAt,
+
+		UserTime:   state.UserTime(),
+		SystemTime: state.SystemTime(),
+	}
+
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		exit.Signal = ws.Signal()
+		exit.CoreDumped = ws.CoreDump()
+	}
+
+	if rusage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		exit.MaxRSS = int64(rusage.Maxrss)
+		// Linux reports it in kilobytes, darwin in bytes.
+		if runtime.GOOS != "darwin" {
+			exit.MaxRSS *= 1024
+		}
+	}
+
+	return exit
+}
+
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGABRT:   "SIGABRT",
+	syscall.SIGALRM:   "SIGALRM",
+	syscall.SIGBUS:    "SIGBUS",
+	syscall.SIGCHLD:   "SIGCHLD",
+	syscall.SIGCONT:   "SIGCONT",
+	syscall.SIGFPE:    "SIGFPE",
+	syscall.SIGHUP:    "SIGHUP",
+	syscall.SIGILL:    "SIGILL",
+	syscall.SIGINT:    "SIGINT",
+	syscall.SIGIO:     "SIGIO",
+	syscall.SIGKILL:   "SIGKILL",
+	syscall.SIGPIPE:   "SIGPIPE",
+	syscall.SIGPROF:   "SIGPROF",
+	syscall.SIGQUIT:   "SIGQUIT",
+	syscall.SIGSEGV:   "SIGSEGV",
+	syscall.SIGSTOP:   "SIGSTOP",
+	syscall.SIGSYS:    "SIGSYS",
+	syscall.SIGTERM:   "SIGTERM",
+	syscall.SIGTRAP:   "SIGTRAP",
+	syscall.SIGTSTP:   "SIGTSTP",
+	syscall.SIGTTIN:   "SIGTTIN",
+	syscall.SIGTTOU:   "SIGTTOU",
+	syscall.SIGURG:    "SIGURG",
+	syscall.SIGUSR1:   "SIGUSR1",
+	syscall.SIGUSR2:   "SIGUSR2",
+	syscall.SIGVTALRM: "SIGVTALRM",
+	syscall.SIGWINCH:  "SIGWINCH",
+	syscall.SIGXCPU:   "SIGXCPU",
+	syscall.SIGXFSZ:   "SIGXFSZ",
+}
+
+func SignalName(sig syscall.Signal) string {
+	if name, ok := signalNames[sig]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("SIG%d", int(sig))
+}
+
+// Parses signal names with or without the SIG prefix.
+func ParseSignalName(name string) (syscall.Signal, error) {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	for sig, n := range signalNames {
+		if n == name {
+			return sig, nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid signal name: %s", name)
+}
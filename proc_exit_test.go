@@ -0,0 +1,85 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func runProcExit(t *testing.T, script string) ProcExit {
+	t.Helper()
+
+	p := NewProc("sh", "-c", script)
+	err := p.Run(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	exit, err := p.GetExit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return exit
+}
+
+func TestProcExit(t *testing.T) {
+	exit := runProcExit(t, "sleep 0.1; exit 3")
+	if exit.Signaled() || exit.Code != 3 {
+		t.Fatalf("unexpected exit: %+v", exit)
+	}
+	if exit.String() != "exited with code 3" {
+		t.Fatalf("unexpected description: %s", exit.String())
+	}
+	if exit.Pid == 0 || exit.MaxRSS <= 0 {
+		t.Fatalf("expected the pid and the usage to be recorded: %+v", exit)
+	}
+	if exit.Runtime() < 100*time.Millisecond {
+		t.Fatalf("unexpected runtime: %s", exit.Runtime())
+	}
+	if !strings.HasPrefix(exit.Usage(), "ran ") ||
+		!strings.Contains(exit.Usage(), "max rss") {
+		t.Fatalf("unexpected usage: %s", exit.Usage())
+	}
+
+	exit = runProcExit(t, "kill -KILL $$")
+	if !exit.Signaled() || exit.Signal != syscall.SIGKILL || exit.Code != -1 {
+		t.Fatalf("unexpected exit: %+v", exit)
+	}
+	if exit.String() != "killed by signal SIGKILL" {
+		t.Fatalf("unexpected description: %s", exit.String())
+	}
+
+	exit.CoreDumped = true
+	if exit.String() != "killed by signal SIGKILL (core dumped)" {
+		t.Fatalf("unexpected description: %s", exit.String())
+	}
+}
+
+func TestSignalName(t *testing.T) {
+	if name := SignalName(syscall.SIGTERM); name != "SIGTERM" {
+		t.Fatalf("unexpected name: %s", name)
+	}
+	if name := SignalName(syscall.Signal(99)); name != "SIG99" {
+		t.Fatalf("unexpected name: %s", name)
+	}
+}
+
+func TestParseSignalName(t *testing.T) {
+	for _, name := range []string{"SIGHUP", "hup", "Hup"} {
+		sig, err := ParseSignalName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sig != syscall.SIGHUP {
+			t.Fatalf("%s: unexpected signal: %d", name, sig)
+		}
+	}
+	_, err := ParseSignalName("SIGNOTHING")
+	if err == nil {
+		t.Fatal("expected an invalid signal name to fail")
+	}
+}
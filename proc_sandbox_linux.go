@@ -0,0 +1,401 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// See capabilities(7).
+var capabilities = map[string]int{
+	"CAP_CHOWN":              0,
+	"CAP_DAC_OVERRIDE":       1,
+	"CAP_DAC_READ_SEARCH":    2,
+	"CAP_FOWNER":             3,
+	"CAP_FSETID":             4,
+	"CAP_KILL":               5,
+	"CAP_SETGID":             6,
+	"CAP_SETUID":             7,
+	"CAP_SETPCAP":            8,
+	"CAP_LINUX_IMMUTABLE":    9,
+	"CAP_NET_BIND_SERVICE":   10,
+	"CAP_NET_BROADCAST":      11,
+	"CAP_NET_ADMIN":          12,
+	"CAP_NET_RAW":            13,
+	"CAP_IPC_LOCK":           14,
+	"CAP_IPC_OWNER":          15,
+	"CAP_SYS_MODULE":         16,
+	"CAP_SYS_RAWIO":          17,
+	"CAP_SYS_CHROOT":         18,
+	"CAP_SYS_PTRACE":         19,
+	"CAP_SYS_PACCT":          20,
+	"CAP_SYS_ADMIN":          21,
+	"CAP_SYS_BOOT":           22,
+	"CAP_SYS_NICE":           23,
+	"CAP_SYS_RESOURCE":       24,
+	"CAP_SYS_TIME":           25,
+	"CAP_SYS_TTY_CONFIG":     26,
+	"CAP_MKNOD":              27,
+	"CAP_LEASE":              28,
+	"CAP_AUDIT_WRITE":        29,
+	"CAP_AUDIT_CONTROL":      30,
+	"CAP_SETFCAP":            31,
+	"CAP_MAC_OVERRIDE":       32,
+	"CAP_MAC_ADMIN":          33,
+	"CAP_SYSLOG":             34,
+	"CAP_WAKE_ALARM":         35,
+	"CAP_BLOCK_SUSPEND":      36,
+	"CAP_AUDIT_READ":         37,
+	"CAP_PERFMON":            38,
+	"CAP_BPF":                39,
+	"CAP_CHECKPOINT_RESTORE": 40,
+}
+
+// See prctl(2) and capset(2).
+const (
+	prSetKeepCaps        = 8
+	prCapBsetDrop        = 24
+	prSetNoNewPrivs      = 38
+	prCapAmbient         = 47
+	prCapAmbientRaise    = 2
+	linuxCapabilityVer3  = 0x20080522
+	siocGetInterfaceFlag = 0x8913
+	siocSetInterfaceFlag = 0x8914
+)
+
+func parseCapability(name string) (int, error) {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "CAP_") {
+		name = "CAP_" + name
+	}
+
+	c, ok := capabilities[name]
+	if !ok {
+		return 0, fmt.Errorf("invalid capability: %s", name)
+	}
+
+	return c, nil
+}
+
+func (this *ProcAttr) setSysProcAttr(cmd *exec.Cmd) {
+	var flags uintptr = 0
+	if this.needsMountNamespace() {
+		flags |= syscall.CLONE_NEWNS
+	}
+	if this.PrivateNetwork {
+		flags |= syscall.CLONE_NEWNET
+	}
+	if flags == 0 {
+		return
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Cloneflags |= flags
+}
+
+func (this *ProcAttr) needsMountNamespace() bool {
+	return this.PrivateTmp || len(this.ReadOnlyPaths) != 0 ||
+		len(this.InaccessiblePaths) != 0
+}
+
+// Applied while the process still has the privileges of the daemon.
+func (this *ProcAttr) applySandbox() error {
+	if this.needsMountNamespace() {
+		err := this.applyMounts()
+		if err != nil {
+			return err
+		}
+	}
+
+	if this.PrivateNetwork {
+		err := setLoopbackUp()
+		if err != nil {
+			return fmt.Errorf("setting up loopback failed: %w", err)
+		}
+	}
+
+	if this.RootDirectory != "" {
+		err := chroot(this.RootDirectory)
+		if err != nil {
+			return fmt.Errorf("changing root directory failed: %w", err)
+		}
+	}
+
+	if this.CapabilityBoundingSet != nil {
+		err := dropBoundingSet(*this.CapabilityBoundingSet)
+		if err != nil {
+			return fmt.Errorf("dropping capabilities failed: %w", err)
+		}
+	}
+
+	// Otherwise the capabilities are gone once the uid changes.
+	if len(this.AmbientCapabilities) != 0 && this.Uid != nil {
+		err := prctl(prSetKeepCaps, 1, 0)
+		if err != nil {
+			return fmt.Errorf("keeping capabilities failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Applied after the credentials have changed.
+func (this *ProcAttr) applyPrivileges() error {
+	if len(this.AmbientCapabilities) != 0 {
+		err := raiseAmbient(this.AmbientCapabilities)
+		if err != nil {
+			return fmt.Errorf("raising ambient capabilities failed: %w", err)
+		}
+	}
+
+	if this.NoNewPrivileges {
+		err := prctl(prSetNoNewPrivs, 1, 0)
+		if err != nil {
+			return fmt.Errorf("setting no new privileges failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (this *ProcAttr) applyMounts() error {
+	// Don't let the mounts propagate back to the main mount namespace.
+	err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_SLAVE, "")
+	if err != nil {
+		return fmt.Errorf("making mounts private failed: %w", err)
+	}
+
+	for _, p := range this.ReadOnlyPaths {
+		err := this.forPath(p, func(path string) error {
+			err := syscall.Mount(path, path, "", syscall.MS_BIND|syscall.MS_REC, "")
+			if err != nil {
+				return err
+			}
+
+			return syscall.Mount(
+				"", path, "",
+				syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY, "",
+			)
+		})
+		if err != nil {
+			return fmt.Errorf("mounting %s read-only failed: %w", p, err)
+		}
+	}
+
+	for _, p := range this.InaccessiblePaths {
+		err := this.forPath(p, makeInaccessible)
+		if err != nil {
+			return fmt.Errorf("making %s inaccessible failed: %w", p, err)
+		}
+	}
+
+	if this.PrivateTmp {
+		for _, p := range []string{"/tmp", "-/var/tmp"} {
+			err := this.forPath(p, func(path string) error {
+				return syscall.Mount(
+					"tmpfs", path, "tmpfs",
+					syscall.MS_NOSUID|syscall.MS_NODEV, "mode=1777",
+				)
+			})
+			if err != nil {
+				return fmt.Errorf("mounting private %s failed: %w", p, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Calls fn with the path inside the root directory, paths prefixed with -
+// are skipped when they don't exist.
+func (this *ProcAttr) forPath(p string, fn func(path string) error) error {
+	optional := strings.HasPrefix(p, "-")
+	p = strings.TrimPrefix(p, "-")
+	if this.RootDirectory != "" {
+		p = filepath.Join(this.RootDirectory, p)
+	}
+
+	_, err := os.Lstat(p)
+	if optional && errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return fn(p)
+}
+
+func makeInaccessible(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return syscall.Mount(
+			"tmpfs", path, "tmpfs",
+			syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC,
+			"mode=000",
+		)
+	}
+
+	// Files can only be covered by other files, the bind mount keeps the
+	// file alive after it gets removed.
+	f, err := os.CreateTemp("", "ella-inaccessible-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	err = os.Chmod(f.Name(), 0)
+	if err != nil {
+		return err
+	}
+	err = syscall.Mount(f.Name(), path, "", syscall.MS_BIND, "")
+	if err != nil {
+		return err
+	}
+
+	return syscall.Mount(
+		"", path, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY, "",
+	)
+}
+
+func chroot(root string) error {
+	// The working directory is kept when it exists in the root directory.
+	cwd, err := os.Getwd()
+	if err != nil {
+		cwd = "/"
+	}
+
+	err = syscall.Chroot(root)
+	if err != nil {
+		return err
+	}
+
+	if syscall.Chdir(cwd) != nil {
+		return syscall.Chdir("/")
+	}
+	return nil
+}
+
+func setLoopbackUp() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	// struct ifreq, flags come right after the name.
+	var ifreq struct {
+		name  [syscall.IFNAMSIZ]byte
+		flags uint16
+		_     [22]byte
+	}
+	copy(ifreq.name[:], "lo")
+
+	err = ioctl(fd, siocGetInterfaceFlag, unsafe.Pointer(&ifreq))
+	if err != nil {
+		return err
+	}
+	ifreq.flags |= syscall.IFF_UP
+
+	return ioctl(fd, siocSetInterfaceFlag, unsafe.Pointer(&ifreq))
+}
+
+func dropBoundingSet(keep []int) error {
+	b, err := os.ReadFile("/proc/sys/kernel/cap_last_cap")
+	if err != nil {
+		return err
+	}
+	last, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return err
+	}
+
+	for c := 0; c <= last; c++ {
+		if slices.Contains(keep, c) {
+			continue
+		}
+
+		err := prctl(prCapBsetDrop, uintptr(c), 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func raiseAmbient(caps []int) error {
+	header := struct {
+		version uint32
+		pid     int32
+	}{linuxCapabilityVer3, 0}
+	var data [2]struct {
+		effective   uint32
+		permitted   uint32
+		inheritable uint32
+	}
+
+	// Ambient capabilities have to be permitted and inheritable.
+	for _, c := range caps {
+		data[c/32].effective |= 1 << (c % 32)
+		data[c/32].permitted |= 1 << (c % 32)
+		data[c/32].inheritable |= 1 << (c % 32)
+	}
+	_, _, errno := syscall.RawSyscall(
+		syscall.SYS_CAPSET,
+		uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data)), 0,
+	)
+	if errno != 0 {
+		return errno
+	}
+
+	for _, c := range caps {
+		err := prctl(prCapAmbient, prCapAmbientRaise, uintptr(c))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func prctl(option, arg2, arg3 uintptr) error {
+	_, _, errno := syscall.RawSyscall6(
+		syscall.SYS_PRCTL, option, arg2, arg3, 0, 0, 0,
+	)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+func ioctl(fd int, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(
+		syscall.SYS_IOCTL, uintptr(fd), req, uintptr(arg),
+	)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
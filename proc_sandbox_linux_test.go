@@ -0,0 +1,165 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thekhanj/ella/config"
+)
+
+func TestParseCapability(t *testing.T) {
+	tests := map[string]int{
+		"CAP_CHOWN":        0,
+		"net_bind_service": 10,
+		"Sys_Admin":        21,
+	}
+	for name, expected := range tests {
+		c, err := parseCapability(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c != expected {
+			t.Fatalf("%s: expected %d, got %d", name, expected, c)
+		}
+	}
+
+	_, err := parseCapability("CAP_NOTHING")
+	if err == nil {
+		t.Fatal("expected an invalid capability to fail")
+	}
+}
+
+func TestProcAttrFromConfigCapabilities(t *testing.T) {
+	attr, err := NewProcAttrFromConfig(&config.Proc{
+		CapabilityBoundingSet: []config.Capability{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attr.CapabilityBoundingSet == nil || *attr.CapabilityBoundingSet == nil {
+		t.Fatal("expected an empty bounding set to drop every capability")
+	}
+	if attr.AmbientCapabilities != nil {
+		t.Fatalf("unexpected ambient capabilities: %v", attr.AmbientCapabilities)
+	}
+
+	ret := roundTripProcAttr(t, attr)
+	if ret.CapabilityBoundingSet == nil || *ret.CapabilityBoundingSet == nil ||
+		len(*ret.CapabilityBoundingSet) != 0 {
+		t.Fatalf(
+			"expected an empty bounding set, got: %v", ret.CapabilityBoundingSet,
+		)
+	}
+
+	attr, err = NewProcAttrFromConfig(&config.Proc{
+		CapabilityBoundingSet: []config.Capability{"CAP_CHOWN", "CAP_KILL"},
+		AmbientCapabilities:   []config.Capability{"CAP_KILL"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret = roundTripProcAttr(t, attr)
+	if len(*ret.CapabilityBoundingSet) != 2 ||
+		len(ret.AmbientCapabilities) != 1 || ret.AmbientCapabilities[0] != 5 {
+		t.Fatalf("unexpected capabilities: %+v", ret)
+	}
+
+	_, err = NewProcAttrFromConfig(&config.Proc{
+		CapabilityBoundingSet: []config.Capability{"CAP_CHOWN"},
+		AmbientCapabilities:   []config.Capability{"CAP_KILL"},
+	})
+	if err == nil {
+		t.Fatal("expected ambient capabilities outside the bounding set to fail")
+	}
+}
+
+// Returns the value of a field of /proc/self/status printed by the process.
+func procStatusField(t *testing.T, attr *ProcAttr, field string) string {
+	t.Helper()
+
+	p := NewProc("/usr/bin/sh", "-c", "cat /proc/self/status")
+	p.Attr = attr
+	for _, line := range strings.Split(runProcOutput(t, p), "\n") {
+		key, val, ok := strings.Cut(line, ":")
+		if ok && key == field {
+			return strings.TrimSpace(val)
+		}
+	}
+
+	t.Fatalf("%s not found in the status of the process", field)
+	return ""
+}
+
+func TestSandboxCapabilityBoundingSet(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("dropping capabilities requires root")
+	}
+
+	empty := []int{}
+	bnd := procStatusField(t, &ProcAttr{CapabilityBoundingSet: &empty}, "CapBnd")
+	if bnd != "0000000000000000" {
+		t.Fatalf("expected every capability to be dropped, got: %s", bnd)
+	}
+
+	keep := []int{0, 10}
+	bnd = procStatusField(t, &ProcAttr{CapabilityBoundingSet: &keep}, "CapBnd")
+	if bnd != "0000000000000401" {
+		t.Fatalf("expected CAP_CHOWN and CAP_NET_BIND_SERVICE, got: %s", bnd)
+	}
+}
+
+func TestSandboxReadOnlyPaths(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("mount namespaces require root")
+	}
+
+	dir := t.TempDir()
+	p := NewProc("/usr/bin/sh", "-c", "echo x > "+filepath.Join(dir, "f"))
+	p.Attr = &ProcAttr{ReadOnlyPaths: []string{dir}}
+	runProcOutput(t, p)
+
+	exit, err := p.GetExit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exit.Code == 0 {
+		t.Fatal("expected writing to a read-only path to fail")
+	}
+	_, err = os.Stat(filepath.Join(dir, "f"))
+	if !os.IsNotExist(err) {
+		t.Fatal("expected the file not to be created")
+	}
+
+	// The mount doesn't propagate back to the daemon.
+	err = os.WriteFile(filepath.Join(dir, "f"), []byte("x"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSandboxPrivateNetwork(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("network namespaces require root")
+	}
+
+	p := NewProc("/usr/bin/sh", "-c", "cat /proc/net/dev")
+	p.Attr = &ProcAttr{PrivateNetwork: true}
+
+	ifaces := make([]string, 0)
+	for _, line := range strings.Split(runProcOutput(t, p), "\n") {
+		name, _, ok := strings.Cut(line, ":")
+		if ok {
+			ifaces = append(ifaces, strings.TrimSpace(name))
+		}
+	}
+	if len(ifaces) != 1 || ifaces[0] != "lo" {
+		t.Fatalf("expected only the loopback interface, got: %v", ifaces)
+	}
+}
@@ -0,0 +1,37 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+var procErrSandboxUnsupported = errors.New("sandboxing is only supported on linux")
+
+func parseCapability(name string) (int, error) {
+	return 0, procErrSandboxUnsupported
+}
+
+func (this *ProcAttr) setSysProcAttr(cmd *exec.Cmd) {}
+
+func (this *ProcAttr) applySandbox() error {
+	if this.PrivateTmp || len(this.ReadOnlyPaths) != 0 ||
+		len(this.InaccessiblePaths) != 0 || this.PrivateNetwork ||
+		this.RootDirectory != "" {
+		return procErrSandboxUnsupported
+	}
+
+	return nil
+}
+
+func (this *ProcAttr) applyPrivileges() error {
+	if this.NoNewPrivileges {
+		return procErrSandboxUnsupported
+	}
+
+	return nil
+}
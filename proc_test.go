@@ -6,12 +6,25 @@ package main
 import (
 	"context"
 	"io"
+	"os"
 	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/thekhanj/ella/config"
 )
 
+// The test binary stands in for ella when processes are executed by the
+// exec helper.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == procAttrHelperCmd {
+		os.Exit(RunProcAttrHelper(os.Args[2:]))
+	}
+
+	os.Exit(m.Run())
+}
+
 type ProcPipesTest struct {
 	t      *testing.T
 	shell  string
@@ -180,3 +193,39 @@ func TestProcStates(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestProcAttr(t *testing.T) {
+	nice := 5
+	p := NewProc("/usr/bin/sh", "-c", `
+		echo $(ulimit -Sn) $(ulimit -Hn) $(cut -d' ' -f19 /proc/$$/stat)`,
+	)
+	p.Attr = &ProcAttr{
+		Limits: []config.ResourceLimit{{Name: "nofile", Soft: 512, Hard: 1024}},
+		Nice:   &nice,
+	}
+	stdout := p.StdoutPipe()
+	defer stdout.Close()
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		err := p.Run(ctx)
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+
+	b, err := io.ReadAll(stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "512 1024 5\n" {
+		t.Errorf("unexpected standard output: %s", string(b))
+	}
+
+	<-done
+}
@@ -4,6 +4,7 @@
 package main
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"io"
@@ -24,9 +25,19 @@ type Procs struct {
 }
 
 func (this *Procs) Push(proc *Proc) {
+	this.Add(proc)
+	this.SetLast(proc)
+}
+
+// Adds the output of the process without making it the last process, e.g.
+// while it's starting next to the last one.
+func (this *Procs) Add(proc *Proc) {
 	if this.running.Load() {
 		this.procs.Pub(proc, 0)
 	}
+}
+
+func (this *Procs) SetLast(proc *Proc) {
 	this.mu.Lock()
 	this.last = proc
 	this.mu.Unlock()
@@ -60,6 +71,9 @@ func (this *Procs) StderrPipe() io.ReadCloser {
 	)
 }
 
+// Copies the outputs of the processes as they're pushed, the outputs of
+// processes running side by side, e.g. while one replaces the other, are
+// interleaved line by line.
 func (this *Procs) pipe(
 	getPipe func(proc *Proc) io.ReadCloser,
 ) io.ReadCloser {
@@ -67,13 +81,25 @@ func (this *Procs) pipe(
 	go func() {
 		defer w.Close()
 
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		copyOutput := func(proc *Proc) {
+			// Nothing gets lost once the pipe is there.
+			r := getPipe(proc)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				err := copyLines(w, r)
+				if err != nil {
+					fmt.Println("procs:", err)
+				}
+			}()
+		}
+
 		last, err := this.Last()
 		if err == nil {
-			_, err := io.Copy(w, getPipe(last))
-			if err != nil {
-				fmt.Println("procs:", err)
-				return
-			}
+			copyOutput(last)
 		}
 
 		if !this.running.Load() {
@@ -89,17 +115,34 @@ func (this *Procs) pipe(
 		}()
 
 		for proc := range ch {
-			_, err := io.Copy(w, getPipe(proc))
-			if err != nil {
-				fmt.Println("procs:", err)
-				return
-			}
+			copyOutput(proc)
 		}
 	}()
 
 	return r
 }
 
+// Writes r to w a line at a time, so lines of concurrent writers don't get
+// mixed up.
+func copyLines(w io.Writer, r io.Reader) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) != 0 {
+			_, werr := w.Write(line)
+			if werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
 func NewProcs() *Procs {
 	ret := &Procs{
 		mu:   sync.RWMutex{},
@@ -0,0 +1,133 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/thekhanj/ella/config"
+)
+
+type ExitStatusSet struct {
+	codes   map[int]struct{}
+	signals map[syscall.Signal]struct{}
+}
+
+func (this *ExitStatusSet) Match(exit *ProcExit) bool {
+	if exit.Signaled() {
+		_, ok := this.signals[exit.Signal]
+		return ok
+	}
+
+	_, ok := this.codes[exit.Code]
+	return ok
+}
+
+func NewExitStatusSetFromConfig(
+	cfg config.ExitStatuses,
+) (*ExitStatusSet, error) {
+	set := &ExitStatusSet{
+		codes:   make(map[int]struct{}),
+		signals: make(map[syscall.Signal]struct{}),
+	}
+
+	for _, code := range cfg.Codes {
+		set.codes[code] = struct{}{}
+	}
+	for _, name := range cfg.Signals {
+		sig, err := ParseSignalName(name)
+		if err != nil {
+			return nil, err
+		}
+		set.signals[sig] = struct{}{}
+	}
+
+	return set, nil
+}
+
+type RestartMode int
+
+const (
+	RestartModeAlways RestartMode = iota
+	RestartModeOnFailure
+	RestartModeNever
+)
+
+// Decides whether a process exiting on its own gets restarted automatically.
+type RestartPolicy struct {
+	Mode    RestartMode
+	Backoff time.Duration
+
+	prevent *ExitStatusSet
+	force   *ExitStatusSet
+}
+
+func (this *RestartPolicy) ShouldRestart(exit *ProcExit, failed bool) bool {
+	if this.prevent.Match(exit) {
+		return false
+	}
+	if this.force.Match(exit) {
+		return true
+	}
+
+	switch this.Mode {
+	case RestartModeAlways:
+		return true
+	case RestartModeOnFailure:
+		return failed
+	default:
+		return false
+	}
+}
+
+func NewRestartPolicyFromConfig(cfg *config.Service) (*RestartPolicy, error) {
+	strategy, err := cfg.GetRestart()
+	if err != nil {
+		return nil, err
+	}
+
+	var mode RestartMode
+	var backoff config.Duration
+	if always, ok := strategy.(*config.AlwaysRestart); ok {
+		mode, backoff = RestartModeAlways, always.Backoff
+	} else if onFailure, ok := strategy.(*config.OnFailureRestart); ok {
+		mode, backoff = RestartModeOnFailure, onFailure.Backoff
+	} else if never, ok := strategy.(*config.NeverRestart); ok {
+		mode, backoff = RestartModeNever, never.Backoff
+	} else {
+		return nil, fmt.Errorf("invalid restart strategy config: %v", strategy)
+	}
+
+	d, err := time.ParseDuration(string(backoff))
+	if err != nil {
+		return nil, err
+	}
+
+	preventCfg, err := cfg.GetRestartPreventExitStatus()
+	if err != nil {
+		return nil, err
+	}
+	prevent, err := NewExitStatusSetFromConfig(preventCfg)
+	if err != nil {
+		return nil, err
+	}
+	forceCfg, err := cfg.GetRestartForceExitStatus()
+	if err != nil {
+		return nil, err
+	}
+	force, err := NewExitStatusSetFromConfig(forceCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RestartPolicy{
+		Mode:    mode,
+		Backoff: d,
+
+		prevent: prevent,
+		force:   force,
+	}, nil
+}
@@ -0,0 +1,80 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/thekhanj/ella/config"
+)
+
+type RestartPolicyTest struct {
+	t       *testing.T
+	mode    RestartMode
+	prevent config.ExitStatuses
+	force   config.ExitStatuses
+	exit    ProcExit
+	failed  bool
+	// Expected result of ShouldRestart.
+	restart bool
+}
+
+func (this *RestartPolicyTest) Run() {
+	prevent, err := NewExitStatusSetFromConfig(this.prevent)
+	if err != nil {
+		this.t.Fatal(err)
+	}
+	force, err := NewExitStatusSetFromConfig(this.force)
+	if err != nil {
+		this.t.Fatal(err)
+	}
+
+	p := RestartPolicy{Mode: this.mode, prevent: prevent, force: force}
+	restart := p.ShouldRestart(&this.exit, this.failed)
+	if restart != this.restart {
+		this.t.Errorf(
+			"unexpected restart: expected: %t received: %t",
+			this.restart, restart,
+		)
+	}
+}
+
+func TestRestartPolicy(t *testing.T) {
+	none := config.ExitStatuses{}
+	sigterm := ProcExit{Code: -1, Signal: syscall.SIGTERM}
+
+	tests := []RestartPolicyTest{
+		{t, RestartModeAlways, none, none, ProcExit{}, false, true},
+		{t, RestartModeOnFailure, none, none, ProcExit{}, false, false},
+		{t, RestartModeOnFailure, none, none, ProcExit{Code: 1}, true, true},
+		{t, RestartModeNever, none, none, ProcExit{Code: 1}, true, false},
+		{
+			t, RestartModeAlways, config.ExitStatuses{Codes: []int{75}}, none,
+			ProcExit{Code: 75}, true, false,
+		},
+		{
+			t, RestartModeNever, none, config.ExitStatuses{Signals: []string{"TERM"}},
+			sigterm, true, true,
+		},
+		{
+			t, RestartModeAlways,
+			config.ExitStatuses{Signals: []string{"SIGTERM"}},
+			config.ExitStatuses{Signals: []string{"SIGTERM"}},
+			sigterm, true, false,
+		},
+	}
+	for _, rt := range tests {
+		rt.Run()
+	}
+}
+
+func TestExitStatusSetInvalidSignal(t *testing.T) {
+	_, err := NewExitStatusSetFromConfig(
+		config.ExitStatuses{Signals: []string{"SIGNOPE"}},
+	)
+	if err == nil {
+		t.Error("expected an error for an invalid signal name")
+	}
+}
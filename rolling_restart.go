@@ -0,0 +1,105 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rollingRestartMaxUnavailable = 1
+	rollingRestartReadyTimeout   = time.Minute
+	rollingRestartMinReady       = time.Second
+)
+
+// Restarts the services in batches of at most maxUnavailable services, each
+// batch waits for the previous one to become active again and stay active
+// for minReady, so processes crashing right after starting are caught. It
+// stops at the first batch with a service which doesn't become active within
+// timeout.
+func RollingRestart(
+	w io.Writer, services []*Service,
+	maxUnavailable int, timeout, minReady time.Duration,
+) error {
+	if maxUnavailable < 1 {
+		return fmt.Errorf("invalid max unavailable: %d", maxUnavailable)
+	}
+
+	restarted := 0
+	for batch := range slices.Chunk(services, maxUnavailable) {
+		errs := make([]error, len(batch))
+		var wg sync.WaitGroup
+		wg.Add(len(batch))
+		for i, s := range batch {
+			go func() {
+				defer wg.Done()
+
+				errs[i] = restartAndWait(s, timeout, minReady)
+			}()
+		}
+		wg.Wait()
+
+		err := errors.Join(errs...)
+		if err != nil {
+			restarted += len(batch)
+			if restarted < len(services) {
+				names := make([]string, 0)
+				for _, s := range services[restarted:] {
+					names = append(names, s.Name)
+				}
+				err = fmt.Errorf(
+					"%w\nrolling restart aborted, not restarted: %s",
+					err, strings.Join(names, ", "),
+				)
+			}
+			return err
+		}
+
+		for _, s := range batch {
+			fmt.Fprintf(w, "%s: restarted\n", s.Name)
+		}
+		restarted += len(batch)
+	}
+
+	return nil
+}
+
+func restartAndWait(s *Service, timeout, minReady time.Duration) error {
+	err := s.Restart()
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.Name, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	state, err := s.WaitState(ctx, func(state ServiceState) bool {
+		return state == ServiceStateActive || state.IsStopped()
+	})
+	if err != nil {
+		return fmt.Errorf("%s: not active after %s", s.Name, timeout)
+	}
+	if state != ServiceStateActive {
+		return fmt.Errorf("%s: %s after restart", s.Name, state.Name())
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), minReady)
+	defer cancel()
+
+	state, err = s.WaitState(ctx, func(state ServiceState) bool {
+		return state != ServiceStateActive
+	})
+	if err == nil {
+		return fmt.Errorf("%s: %s after restart", s.Name, state.Name())
+	}
+
+	return nil
+}
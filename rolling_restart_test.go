@@ -0,0 +1,95 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Returns a running service whose process fails once failFile exists.
+func newRollingRestartTestService(
+	ctx context.Context, name, failFile string,
+) *Service {
+	exec := func() (*Proc, error) {
+		return NewProc(
+			"sh", "-c", "if [ -e \"$0\" ]; then exit 1; fi; exec sleep 10",
+			failFile,
+		), nil
+	}
+	watchdog := NewSimpleWatchdog(
+		exec,
+		&StopSignalProcAction{timeout: time.Second, signal: syscall.SIGTERM},
+		&ReloadSignalProcAction{signal: syscall.SIGHUP},
+		nil,
+	)
+	s := NewService(name, watchdog, ServiceOptions{})
+	go s.Run(ctx)
+
+	return s
+}
+
+func TestRollingRestart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	services := make([]*Service, 0)
+	for _, name := range []string{"web.1", "web.2", "web.3", "web.4"} {
+		s := newRollingRestartTestService(ctx, name, filepath.Join(dir, name))
+		err := s.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = s.WaitState(ctx, func(state ServiceState) bool {
+			return state == ServiceStateActive
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		services = append(services, s)
+	}
+	defer func() {
+		for _, s := range services {
+			s.Stop()
+		}
+	}()
+
+	err := RollingRestart(io.Discard, services, 2, time.Second, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range services {
+		if s.GetState() != ServiceStateActive {
+			t.Fatalf("%s: expected active, got %s", s.Name, s.GetState().Name())
+		}
+	}
+
+	os.WriteFile(filepath.Join(dir, "web.2"), []byte{}, 0644)
+	pids := make([]int, 0)
+	for _, s := range services {
+		pid, _ := s.Pid()
+		pids = append(pids, pid)
+	}
+
+	err = RollingRestart(io.Discard, services, 1, time.Second, 100*time.Millisecond)
+	if err == nil {
+		t.Fatal("expected the rolling restart to abort")
+	}
+	if !strings.Contains(err.Error(), "web.2: failed") ||
+		!strings.Contains(err.Error(), "not restarted: web.3, web.4") {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for i, s := range services[2:] {
+		if pid, _ := s.Pid(); pid != pids[i+2] {
+			t.Fatalf("%s: restarted after the rolling restart aborted", s.Name)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/thekhanj/ella/config"
+)
+
+// How long the command of a secret has to print the secret in.
+const secretCommandTimeout = 30 * time.Second
+
+// What secrets are replaced with in the logs.
+const secretRedacted = "<redacted>"
+
+// Lines of secrets shorter than this aren't redacted, e.g. 1 or true would
+// rewrite unrelated text.
+const secretMinRedactedLen = 6
+
+// An environment variable read each time a process gets spawned, from either
+// a file or the output of a command.
+type EnvSecret struct {
+	Name string
+
+	path string
+	// Command line, the command runs with the credentials of the process.
+	args       []string
+	createProc CreateProc
+	ttl        time.Duration
+	// Owner of the process, who besides the daemon may own the file.
+	uid uint32
+
+	mu        sync.Mutex
+	value     string
+	fetchedAt time.Time
+	// Lines of the last value read, the logs are redacted without waiting
+	// for a command to finish.
+	redacted atomic.Pointer[[]string]
+}
+
+// Returns the KEY=value pair of the secret.
+func (this *EnvSecret) EnvVar() (string, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.args != nil && this.ttl > 0 && !this.fetchedAt.IsZero() &&
+		time.Since(this.fetchedAt) < this.ttl {
+		return fmt.Sprintf("%s=%s", this.Name, this.value), nil
+	}
+
+	var value string
+	var err error
+	if this.args != nil {
+		value, err = this.runCommand()
+	} else {
+		value, err = this.readFile()
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading secret %s failed: %w", this.Name, err)
+	}
+
+	this.value = strings.TrimSpace(value)
+	this.fetchedAt = time.Now()
+	lines := make([]string, 0)
+	for _, line := range strings.Split(this.value, "\n") {
+		if line = strings.TrimSpace(line); len(line) >= secretMinRedactedLen {
+			lines = append(lines, line)
+		}
+	}
+	this.redacted.Store(&lines)
+
+	return fmt.Sprintf("%s=%s", this.Name, this.value), nil
+}
+
+// Replaces the secret's lines in s, except for the short ones.
+func (this *EnvSecret) Redact(s string) string {
+	lines := this.redacted.Load()
+	if lines == nil {
+		return s
+	}
+
+	for _, line := range *lines {
+		s = strings.ReplaceAll(s, line, secretRedacted)
+	}
+
+	return s
+}
+
+// Where the secret is read from, it's safe to be shown.
+func (this *EnvSecret) Source() string {
+	if this.args != nil {
+		return "command " + strings.Join(this.args, " ")
+	}
+
+	return "file " + this.path
+}
+
+func (this *EnvSecret) readFile() (string, error) {
+	f, err := os.Open(this.path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf(
+			"%s is accessible by other users, mode: %#o",
+			this.path, info.Mode().Perm(),
+		)
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		if st.Uid != uint32(syscall.Getuid()) && st.Uid != this.uid {
+			return "", fmt.Errorf("%s is owned by another user", this.path)
+		}
+	}
+
+	b, err := io.ReadAll(f)
+	return string(b), err
+}
+
+func (this *EnvSecret) runCommand() (string, error) {
+	ctx, cancel := context.WithTimeout(
+		context.Background(), secretCommandTimeout,
+	)
+	defer cancel()
+
+	proc := this.createProc(this.args[0], this.args[1:]...)
+	stdout := proc.StdoutPipe()
+	stderr := proc.StderrPipe()
+	var out, errOut []byte
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+
+		out, _ = io.ReadAll(stdout)
+	}()
+	go func() {
+		defer wg.Done()
+
+		errOut, _ = io.ReadAll(stderr)
+	}()
+
+	err := proc.Run(ctx)
+	wg.Wait()
+	if err != nil {
+		return "", err
+	}
+
+	exit, err := proc.GetExit()
+	if err != nil {
+		return "", err
+	}
+	if exit.Signaled() || exit.Code != 0 {
+		msg := strings.TrimSpace(string(errOut))
+		if msg == "" {
+			return "", errors.New(exit.String())
+		}
+		return "", fmt.Errorf("%s: %s", exit.String(), msg)
+	}
+
+	return string(out), nil
+}
+
+// Commands are interpolated from vars right away, createProc creates the
+// processes of the commands.
+func NewEnvSecretFromConfig(
+	cfg config.SecretEnv, createProc CreateProc, vars config.Vars, uid uint32,
+) (*EnvSecret, error) {
+	var args []string = nil
+	if cfg.Path == "" {
+		parts, err := ParseCommandLine(cfg.Exec)
+		if err != nil {
+			return nil, err
+		}
+		args, err = config.InterpolateAll(parts, vars)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &EnvSecret{
+		Name: cfg.Key,
+
+		path:       cfg.Path,
+		args:       args,
+		createProc: createProc,
+		ttl:        cfg.Ttl,
+		uid:        uid,
+
+		mu:        sync.Mutex{},
+		value:     "",
+		fetchedAt: time.Time{},
+		redacted:  atomic.Pointer[[]string]{},
+	}, nil
+}
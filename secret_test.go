@@ -0,0 +1,126 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/thekhanj/ella/config"
+)
+
+func TestEnvSecretFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	err := os.WriteFile(path, []byte("  hunter2\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := NewEnvSecretFromConfig(
+		config.SecretEnv{Key: "PASSWORD", Path: path}, NewProc, nil,
+		uint32(syscall.Getuid()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = secret.EnvVar()
+	if err == nil {
+		t.Error("expected an error for a secret readable by other users")
+	}
+
+	os.Chmod(path, 0600)
+	env, err := secret.EnvVar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env != "PASSWORD=hunter2" {
+		t.Errorf("unexpected secret: %s", env)
+	}
+
+	redacted := secret.Redact("password is hunter2")
+	if redacted != "password is "+secretRedacted {
+		t.Errorf("secret isn't redacted: %s", redacted)
+	}
+}
+
+func TestEnvSecretRedactShortLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	err := os.WriteFile(path, []byte("1\n  s3cr3t-key  \ntrue\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := NewEnvSecretFromConfig(
+		config.SecretEnv{Key: "PASSWORD", Path: path}, NewProc, nil,
+		uint32(syscall.Getuid()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = secret.EnvVar()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line := "listening on port 1, debug is true"
+	if redacted := secret.Redact(line); redacted != line {
+		t.Errorf("expected ordinary lines to be left intact: %s", redacted)
+	}
+	redacted := secret.Redact("key is s3cr3t-key")
+	if redacted != "key is "+secretRedacted {
+		t.Errorf("secret isn't redacted: %s", redacted)
+	}
+}
+
+func TestEnvSecretCommand(t *testing.T) {
+	counter := filepath.Join(t.TempDir(), "counter")
+	vars := config.NewVars(map[string]string{"COUNTER": counter}, nil)
+
+	secret, err := NewEnvSecretFromConfig(
+		config.SecretEnv{
+			Key:  "TOKEN",
+			Exec: `sh -c "echo >> ${COUNTER}; wc -l < ${COUNTER}"`,
+			Ttl:  time.Hour,
+		},
+		NewProc, vars, uint32(syscall.Getuid()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		env, err := secret.EnvVar()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The output is reused until the ttl is reached.
+		if env != "TOKEN=1" {
+			t.Errorf("unexpected secret: %s", env)
+		}
+	}
+
+	secret.ttl = 0
+	env, err := secret.EnvVar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env != "TOKEN=2" {
+		t.Errorf("unexpected secret: %s", env)
+	}
+
+	failing, err := NewEnvSecretFromConfig(
+		config.SecretEnv{Key: "TOKEN", Exec: "sh -c 'echo denied >&2; exit 1'"},
+		NewProc, vars, uint32(syscall.Getuid()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = failing.EnvVar()
+	if err == nil {
+		t.Error("expected an error for a failing command")
+	}
+}
@@ -9,8 +9,12 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"os"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/cskr/pubsub/v2"
 	"github.com/thekhanj/ella/common"
@@ -27,31 +31,153 @@ const (
 	ServiceStateReloading
 	ServiceStateDeactivating
 	ServiceStateFailed
+	// Stopped for having been idle, started again on the next connection.
+	ServiceStateIdle
 )
 
 func (this ServiceState) IsStopped() bool {
-	return this == ServiceStateInactive || this == ServiceStateFailed
+	return this == ServiceStateInactive || this == ServiceStateFailed ||
+		this == ServiceStateIdle
+}
+
+// Lowercase name of the state, e.g. "active".
+func (this ServiceState) Name() string {
+	return strings.ToLower(strings.TrimPrefix(this.String(), "ServiceState"))
 }
 
 var (
-	ServiceErrAlreadyRunning = errors.New("service already running")
-	ServiceErrAlreadyStopped = errors.New("service already stopped")
-	ServiceErrFailed         = errors.New("service failed")
-	ServiceErrNotActive      = errors.New("service is not active")
+	ServiceErrAlreadyRunning  = errors.New("service already running")
+	ServiceErrAlreadyStopped  = errors.New("service already stopped")
+	ServiceErrFailed          = errors.New("service failed")
+	ServiceErrNotActive       = errors.New("service is not active")
+	ServiceErrRestartCanceled = errors.New("restart canceled")
 )
 
+// Number of the last failures kept for each service.
+const serviceMaxFailures = 10
+
+type ServiceFailure struct {
+	Time time.Time
+	Exit ProcExit
+	// Last lines of the output of the failed process.
+	Output []LogLine
+}
+
+// How long a restart waits for the stopped process to be handled, which
+// includes the execStopPost hooks.
+const serviceRestartTimeout = 5 * time.Minute
+
+// Number of the last process runs kept for each service.
+const serviceMaxHistory = 1000
+
+// What has caused a process of a service to start.
+type ServiceTrigger int
+
+const (
+	ServiceTriggerStart ServiceTrigger = iota
+	ServiceTriggerRestart
+	ServiceTriggerAutoRestart
+	ServiceTriggerSocket
+)
+
+func (this ServiceTrigger) Name() string {
+	switch this {
+	case ServiceTriggerStart:
+		return "start"
+	case ServiceTriggerRestart:
+		return "restart"
+	case ServiceTriggerAutoRestart:
+		return "auto-restart"
+	case ServiceTriggerSocket:
+		return "socket"
+	default:
+		return "unknown"
+	}
+}
+
+// A past run of a service's process.
+type ServiceRun struct {
+	Trigger ServiceTrigger
+	Exit    ProcExit
+}
+
+type LogLine struct {
+	Stream LogStream
+	Text   string
+}
+
+// Settings the processes of a service get spawned with.
+type ServiceSpec struct {
+	Args []string
+	Cwd  string
+	Uid  uint32
+	Gid  uint32
+	Env  []string
+	// Read each time a process gets spawned, their values are redacted from
+	// the logs.
+	Secrets []*EnvSecret
+}
+
 type Service struct {
-	Name     string
+	Name string
+	// Number of the replica, counting from 1, 0 when the service isn't a
+	// replica of another one.
+	Replica  int
 	Watchdog Watchdog
+	Spec     *ServiceSpec
 
 	logB      *Broadcaster
+	logW      *io.PipeWriter
+	logR      *io.PipeReader
+	stdoutB   *Broadcaster
+	stderrB   *Broadcaster
 	logStdout bool
 	logStderr bool
 	log       *log.Logger
-
-	running atomic.Bool
-	state   atomic.Int32
-	bus     *pubsub.PubSub[int, ServiceState]
+	sinks     []LogSink
+	limiter   *LogRateLimiter
+	cgroup    *Cgroup
+	// Nil when the service has no sockets.
+	sockets *SocketActivation
+	// Nil when the processes can't store file descriptors.
+	fdStore *FdStore
+	// Nil when the service isn't stopped when idle.
+	idle  *IdleMonitor
+	hooks *ServiceHooks
+
+	running  atomic.Bool
+	state    atomic.Int32
+	bus      *pubsub.PubSub[int, ServiceState]
+	lastExit atomic.Pointer[ProcExit]
+
+	failuresMu sync.Mutex
+	failures   []ServiceFailure
+
+	historyMu sync.Mutex
+	history   []ServiceRun
+
+	restart *RestartPolicy
+	// Whether restarts start the new process before stopping the running one.
+	startFirst bool
+	// How long the new process of such a restart has to run before the
+	// running one gets stopped.
+	minReady time.Duration
+	// Pending automatic restart, guarded by atomicAction.
+	restartTimer *time.Timer
+	// Restart waiting for its process to stop, the service gets started once
+	// the stopped process is handled, without releasing atomicAction in
+	// between. The result of the start is sent to it. Guarded by
+	// atomicAction.
+	pendingRestart chan error
+	// State the service gets into once its process stops, other than
+	// inactive when it's stopped for being idle or a failed hook. Guarded by
+	// atomicAction.
+	stoppedState ServiceState
+	// Cancels the running execStartPre or execStartPost hooks, nil when
+	// none of them is running. Guarded by hooksMu rather than atomicAction,
+	// since stopping the service cancels them while they hold atomicAction.
+	hooksMu     sync.Mutex
+	cancelHooks context.CancelFunc
 
 	// Ensure the watchdog doesn't leave the service in an inconsistent state,
 	// for example when the process crashes in the middle of reload operation.
@@ -62,42 +188,225 @@ func (this *Service) Run(ctx context.Context) {
 	var wg sync.WaitGroup
 	wg.Add(1)
 
-	r, w := io.Pipe()
-
-	this.log = log.New(
-		w, fmt.Sprintf("%s: ", this.Name), 0,
-	)
-
 	go func() {
 		defer wg.Done()
-		defer w.Close()
 
-		err := this.logB.Run(r)
+		err := this.logB.Run(this.logR)
 		if err != nil {
 			fmt.Printf("%s: logger stopped: %s\n", this.Name, err)
 		}
 	}()
 
+	if this.Watchdog != nil {
+		procs := this.Watchdog.Procs()
+		go this.stdoutB.Run(this.limit(procs.StdoutPipe()))
+		go this.stderrB.Run(this.limit(procs.StderrPipe()))
+	}
+
+	stopSinks := this.runSinks()
+
+	if this.fdStore != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := this.fdStore.Serve(ctx, this.log, this.Pid)
+			if err != nil {
+				this.log.Printf("notify socket failed: %s", err)
+			}
+		}()
+	}
+
+	// Opened up front so connections get queued until the service starts.
+	if this.sockets != nil {
+		err := this.sockets.Open()
+		if err != nil {
+			this.log.Printf("opening sockets failed: %s", err)
+		} else if this.sockets.Lazy || this.idle != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				this.activate(ctx)
+			}()
+		}
+	}
+	if this.idle != nil {
+		this.stdoutB.Add(this.idle)
+		this.stderrB.Add(this.idle)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			this.watchIdle(ctx)
+		}()
+	}
+
 	<-ctx.Done()
-	r.Close()
+	this.atomicAction.Lock()
+	this.cancelRestart()
+	this.atomicAction.Unlock()
+
+	this.logW.Close()
 	wg.Wait()
+	stopSinks()
 	if this.Watchdog != nil {
 		this.Watchdog.Procs().Shutdown()
 	}
+	if this.sockets != nil {
+		err := this.sockets.Close()
+		if err != nil {
+			fmt.Printf("%s: closing sockets failed: %s\n", this.Name, err)
+		}
+	}
+	if this.fdStore != nil {
+		this.fdStore.Clear()
+	}
+}
+
+// Starts the service on connections to its sockets while it's idle, or
+// inactive for a lazy service. A failed service has to be started
+// explicitly.
+func (this *Service) activate(ctx context.Context) {
+	for {
+		_, err := this.WaitState(ctx, this.activatable)
+		if err != nil {
+			return
+		}
+
+		err = this.sockets.Wait(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				this.log.Printf("waiting for connections failed: %s", err)
+			}
+			return
+		}
+
+		this.atomicAction.Lock()
+		if this.activatable(this.GetState()) {
+			this.log.Print("activated by a connection")
+			err = this.start(ServiceTriggerSocket)
+			if err != nil {
+				this.log.Printf("activation failed: %s", err)
+			}
+		}
+		this.atomicAction.Unlock()
+	}
+}
+
+func (this *Service) activatable(state ServiceState) bool {
+	return state == ServiceStateIdle ||
+		state == ServiceStateInactive && this.sockets.Lazy
+}
+
+// Stops the service once it has been active and idle for the idle timeout.
+func (this *Service) watchIdle(ctx context.Context) {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if this.GetState() != ServiceStateActive {
+				continue
+			}
+
+			idle, err := this.idle.Check(now)
+			if err != nil {
+				this.log.Printf(
+					"checking activity failed, not stopping when idle: %s", err,
+				)
+				return
+			}
+			if idle {
+				this.stopIdle()
+			}
+		}
+	}
+}
+
+func (this *Service) stopIdle() {
+	this.atomicAction.Lock()
+	defer this.atomicAction.Unlock()
+
+	if this.GetState() != ServiceStateActive {
+		return
+	}
+	this.log.Printf("idle for %s", this.idle.Timeout)
+
+	this.stoppedState = ServiceStateIdle
+	err := this.stop()
+	if err != nil {
+		this.log.Printf("stopping failed: %s", err)
+	}
+}
+
+// Drops the lines exceeding the service's log rate limit, stdout and stderr
+// share the same limit.
+func (this *Service) limit(r io.ReadCloser) io.ReadCloser {
+	if this.limiter == nil {
+		return r
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer r.Close()
+		defer pw.Close()
+
+		common.ReadLines(r, func(line string) bool {
+			now := time.Now()
+			ok, suppressed, flushAt := this.limiter.Allow(now)
+			if suppressed > 0 {
+				this.log.Printf("%d messages suppressed", suppressed)
+			}
+			// Report the suppressed lines when the interval ends, even if the
+			// process doesn't write anything afterwards.
+			if !flushAt.IsZero() {
+				time.AfterFunc(flushAt.Sub(now), func() {
+					suppressed := this.limiter.Flush(time.Now())
+					if suppressed > 0 {
+						this.log.Printf("%d messages suppressed", suppressed)
+					}
+				})
+			}
+			if !ok {
+				return true
+			}
+
+			_, err := fmt.Fprintln(pw, line)
+			return err == nil
+		})
+	}()
+
+	return pr
 }
 
 func (this *Service) Start() error {
 	this.atomicAction.Lock()
 	defer this.atomicAction.Unlock()
 
-	return this.start()
+	return this.start(ServiceTriggerStart)
 }
 
+// Stored file descriptors are only kept across restarts, stopping the
+// service drops them.
 func (this *Service) Stop() error {
+	interrupted := this.interruptHooks()
 	this.atomicAction.Lock()
 	defer this.atomicAction.Unlock()
 
-	return this.stop()
+	err := this.stop()
+	// Stopped before its process got started.
+	if interrupted && errors.Is(err, ServiceErrAlreadyStopped) {
+		err = nil
+	}
+	if err == nil && this.fdStore != nil {
+		err = this.fdStore.Clear()
+	}
+
+	return err
 }
 
 func (this *Service) Reload() error {
@@ -108,108 +417,359 @@ func (this *Service) Reload() error {
 }
 
 func (this *Service) Restart() error {
+	this.interruptHooks()
 	this.atomicAction.Lock()
-	defer this.atomicAction.Unlock()
+	if this.startFirst && this.Watchdog != nil &&
+		this.GetState() == ServiceStateActive {
+		defer this.atomicAction.Unlock()
 
+		return this.replace()
+	}
 	if !this.GetState().IsStopped() {
 		err := this.stop()
 		if err != nil {
+			this.atomicAction.Unlock()
 			return err
 		}
 	}
+	if this.GetState().IsStopped() {
+		defer this.atomicAction.Unlock()
+
+		return this.start(ServiceTriggerRestart)
+	}
 
-	return this.start()
+	// The stopped process is reported by the watchdog, which needs the lock.
+	done := make(chan error, 1)
+	this.pendingRestart = done
+	this.atomicAction.Unlock()
+
+	timer := time.NewTimer(serviceRestartTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+	}
+
+	this.atomicAction.Lock()
+	defer this.atomicAction.Unlock()
+
+	if this.pendingRestart != done {
+		return <-done
+	}
+	this.pendingRestart = nil
+	return fmt.Errorf(
+		"restart timed out after %s waiting for the service to stop",
+		serviceRestartTimeout,
+	)
+}
+
+// Starts the service for the pending restart, once its process has stopped.
+// Returns whether a restart was pending.
+func (this *Service) finishRestart() bool {
+	done := this.pendingRestart
+	if done == nil {
+		return false
+	}
+	this.pendingRestart = nil
+
+	done <- this.start(ServiceTriggerRestart)
+	return true
 }
 
 func (this *Service) Logs() io.ReadCloser {
+	return this.FormattedLogs(PlainLogFormatter{})
+}
+
+func (this *Service) FormattedLogs(f LogFormatter) io.ReadCloser {
+	lines, unsub := this.lines(this.logStdout, this.logStderr)
+
 	r, w := io.Pipe()
-	this.logB.Add(w)
+	go func() {
+		defer w.Close()
 
-	readers := []io.ReadCloser{r}
-	var stdout, stderr io.ReadCloser = nil, nil
-	if this.logStdout {
-		stdout = this.Watchdog.Procs().StdoutPipe()
-		r, w := io.Pipe()
-		go func() {
-			common.FlushWithContext(
-				fmt.Sprintf("%s[stdout]:", this.Name),
-				w, stdout,
-			)
-		}()
-		readers = append(readers, r)
+		for line := range lines {
+			_, err := fmt.Fprintln(w, f.Format(this.Name, line))
+			if err != nil {
+				unsub()
+			}
+		}
+	}()
+
+	return r
+}
+
+// Subscribes to the lines of the service's streams, stdout and stderr decide
+// whether the outputs of the process are included. Calling the returned
+// function unsubscribes and eventually closes the channel.
+func (this *Service) lines(stdout, stderr bool) (chan LogLine, func()) {
+	streams := map[LogStream]*Broadcaster{LogStreamElla: this.logB}
+	if stdout {
+		streams[LogStreamStdout] = this.stdoutB
 	}
-	if this.logStderr {
-		stderr = this.Watchdog.Procs().StderrPipe()
+	if stderr {
+		streams[LogStreamStderr] = this.stderrB
+	}
+
+	ch := make(chan LogLine)
+	done := make(chan struct{})
+	readers := make([]*io.PipeReader, 0)
+
+	var wg sync.WaitGroup
+	wg.Add(len(streams))
+	for stream, b := range streams {
 		r, w := io.Pipe()
+		b.Add(w)
+		readers = append(readers, r)
+
 		go func() {
-			common.FlushWithContext(
-				fmt.Sprintf("%s[stderr]:", this.Name),
-				w, stderr,
-			)
+			defer wg.Done()
+			defer r.Close()
+
+			common.ReadLines(r, func(line string) bool {
+				select {
+				case ch <- LogLine{stream, this.redact(line)}:
+					return true
+				case <-done:
+					return false
+				}
+			})
 		}()
-		readers = append(readers, r)
 	}
 
-	return common.StreamLines(readers...)
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			close(done)
+			for _, r := range readers {
+				r.Close()
+			}
+		})
+	}
+}
+
+func (this *Service) runSinks() func() {
+	if len(this.sinks) == 0 {
+		return func() {}
+	}
+
+	// Sinks get the outputs regardless of them being echoed to the console.
+	lines, unsub := this.lines(true, true)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		// Only report the first error of a failing sink, until it recovers.
+		failing := make([]bool, len(this.sinks))
+		for line := range lines {
+			for i, sink := range this.sinks {
+				err := sink.Send(this.Name, line.Stream, line.Text)
+				if err != nil && !failing[i] {
+					fmt.Printf("%s: log sink: %s\n", this.Name, err)
+				}
+				failing[i] = err != nil
+			}
+		}
+	}()
+
+	return func() {
+		unsub()
+		<-done
+		for _, sink := range this.sinks {
+			sink.Close()
+		}
+	}
+}
+
+// Returns the failures of the service's processes, oldest first.
+func (this *Service) Failures() []ServiceFailure {
+	this.failuresMu.Lock()
+	defer this.failuresMu.Unlock()
+
+	failures := make([]ServiceFailure, len(this.failures))
+	copy(failures, this.failures)
+	return failures
+}
+
+// Returns the past runs of the service's processes, oldest first.
+func (this *Service) History() []ServiceRun {
+	this.historyMu.Lock()
+	defer this.historyMu.Unlock()
+
+	history := make([]ServiceRun, len(this.history))
+	copy(history, this.history)
+	return history
+}
+
+// Returns the resources used by the processes of the service, when it's
+// running in a cgroup.
+func (this *Service) CgroupStats() (*CgroupStats, error) {
+	if this.cgroup == nil {
+		return nil, errors.ErrUnsupported
+	}
+
+	return this.cgroup.Stats()
 }
 
 func (this *Service) GetState() ServiceState {
 	return ServiceState(this.state.Load())
 }
 
+// Waits for the service to get into a state for which match returns true,
+// and returns the state.
+func (this *Service) WaitState(
+	ctx context.Context, match func(ServiceState) bool,
+) (ServiceState, error) {
+	states := this.bus.Sub(0)
+	defer func() {
+		go this.bus.Unsub(states)
+		for range states {
+		}
+	}()
+
+	for {
+		// The states are published asynchronously, the current one is what
+		// counts.
+		if state := this.GetState(); match(state) {
+			return state, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return this.GetState(), ctx.Err()
+		case <-states:
+		}
+	}
+}
+
+// Returns how the last process of the service terminated, nil if none has.
+func (this *Service) LastExit() *ProcExit {
+	return this.lastExit.Load()
+}
+
+// Returns the pid of the running process of the service.
+func (this *Service) Pid() (int, error) {
+	if this.Watchdog == nil || this.GetState().IsStopped() {
+		return 0, ProcErrNotStarted
+	}
+
+	proc, err := this.Watchdog.Procs().Last()
+	if err != nil {
+		return 0, err
+	}
+	process, err := proc.GetProcess()
+	if err != nil {
+		return 0, err
+	}
+
+	return process.Pid, nil
+}
+
 func (this *Service) setState(state ServiceState) {
 	this.state.Store(int32(state))
 	go this.bus.Pub(state, 0)
 }
 
+// Signals of a process, trigger is what has started the process.
 func (this *Service) handleWatchdogSignals(
-	sigs chan WatchdogSignal,
+	sigs chan WatchdogSignal, trigger ServiceTrigger,
 ) error {
 	sig, ok := <-sigs
 	if !ok {
 		panic("unreachable code")
 	}
-	err := this.handleSingleWdSignal(sig)
+	err := this.handleSingleWdSignal(sig, trigger)
 	if err != nil {
 		return err
 	}
 
 	go func() {
 		for sig := range sigs {
-			this.handleSingleWdSignal(sig)
+			this.handleSingleWdSignal(sig, trigger)
 		}
 	}()
 
 	return nil
 }
 
-func (this *Service) handleSingleWdSignal(sig WatchdogSignal) error {
+func (this *Service) handleSingleWdSignal(
+	sig WatchdogSignal, trigger ServiceTrigger,
+) error {
 	this.atomicAction.Lock()
 	defer this.atomicAction.Unlock()
 
-	switch sig {
+	switch sig.Type {
 	case WatchdogSigStarted:
+		// The following signals are handled even when the hooks fail.
+		if this.startPost() != nil {
+			return nil
+		}
 		this.startDone()
 		return nil
 	case WatchdogSigStopped:
+		stopping := this.GetState() == ServiceStateDeactivating
+		this.exited(sig.Exit, trigger)
+		// Stopped for a failed execStartPost.
+		if this.stoppedState == ServiceStateFailed {
+			this.recordFailure(sig.Proc, sig.Exit)
+		}
+		this.stopPost()
 		this.stopDone()
+		if !stopping {
+			this.scheduleRestart(sig.Exit, false)
+		}
+		this.finishRestart()
+		return nil
+	case WatchdogSigRolledBack:
+		this.exited(sig.Exit, trigger)
+		this.recordFailure(sig.Proc, sig.Exit)
+		return nil
+	// The service keeps running, so execStopPost isn't run.
+	case WatchdogSigReplaced:
+		this.exited(sig.Exit, trigger)
 		return nil
 	case WatchdogSigFailed:
+		this.exited(sig.Exit, trigger)
+		this.recordFailure(sig.Proc, sig.Exit)
+		this.stopPost()
 		this.fail()
+		if !this.finishRestart() {
+			this.scheduleRestart(sig.Exit, true)
+		}
 		return ServiceErrFailed
 	default:
 		return errors.ErrUnsupported
 	}
 }
 
-func (this *Service) start() error {
+func (this *Service) start(trigger ServiceTrigger) error {
 	if !this.GetState().IsStopped() {
 		return ServiceErrAlreadyRunning
 	}
+	this.cancelRestart()
+	this.stoppedState = ServiceStateInactive
 	this.log.Print("starting")
 
 	this.setState(ServiceStateActivating)
 
+	err := this.runStartHooks("execStartPre", this.hooks.StartPre, 0)
+	if err != nil {
+		this.log.Print(err)
+		this.stopPost()
+		if errors.Is(err, context.Canceled) {
+			this.stopDone()
+		} else {
+			this.fail()
+		}
+		return err
+	}
+
 	if this.Watchdog == nil {
 		this.startDone()
 		return nil
@@ -217,22 +777,169 @@ func (this *Service) start() error {
 
 	sigs, err := this.Watchdog.Start()
 	if err != nil {
+		this.stopPost()
 		this.fail()
 		return err
 	}
 
-	go this.handleWatchdogSignals(sigs)
+	go this.handleWatchdogSignals(sigs, trigger)
+
+	return nil
+}
+
+// Restarts the service starting the new process first, the service stays
+// active all along.
+func (this *Service) replace() error {
+	this.cancelRestart()
+	this.log.Print("restarting, starting the new process first")
+
+	pid, _ := this.Pid()
+	err := this.runStartHooks("execStartPre", this.hooks.StartPre, pid)
+	if err != nil {
+		this.log.Printf("restart failed, keeping the running process: %s", err)
+		return err
+	}
+
+	sigs, err := this.Watchdog.Replace(this.minReady)
+	if sigs != nil {
+		go func() {
+			for sig := range sigs {
+				this.handleSingleWdSignal(sig, ServiceTriggerRestart)
+			}
+		}()
+	}
+	if sigs == nil || errors.Is(err, WatchdogErrRolledBack) {
+		this.log.Printf("restart failed, keeping the running process: %s", err)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	err = this.startPost()
+	if err != nil {
+		return err
+	}
 
+	this.log.Print("restarted")
 	return nil
 }
 
+// Stops the service as failed when a hook fails, when they're canceled the
+// service is being stopped already.
+func (this *Service) startPost() error {
+	pid, _ := this.Pid()
+	err := this.runStartHooks("execStartPost", this.hooks.StartPost, pid)
+	if err == nil {
+		return nil
+	}
+	this.log.Print(err)
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	this.stoppedState = ServiceStateFailed
+	stopErr := this.stop()
+	if stopErr != nil {
+		return stopErr
+	}
+
+	return err
+}
+
+// Runs once the process has exited or failed to start, failures only get
+// logged.
+func (this *Service) stopPost() {
+	err := this.runHooks(
+		context.Background(), "execStopPost", this.hooks.StopPost, 0,
+	)
+	if err != nil {
+		this.log.Print(err)
+	}
+}
+
+// Output of the hooks is a part of the output of the process.
+func (this *Service) runHooks(
+	ctx context.Context, name string, hooks []*Hook, mainPid int,
+) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	var procs *Procs = nil
+	if this.Watchdog != nil {
+		procs = this.Watchdog.Procs()
+	}
+	err := runHooks(ctx, hooks, procs, mainPid)
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+
+	return nil
+}
+
+// Runs hooks that stopping or restarting the service cancels, so neither
+// waits for them while they hold atomicAction.
+func (this *Service) runStartHooks(
+	name string, hooks []*Hook, mainPid int,
+) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	this.hooksMu.Lock()
+	this.cancelHooks = cancel
+	this.hooksMu.Unlock()
+	defer func() {
+		this.hooksMu.Lock()
+		this.cancelHooks = nil
+		this.hooksMu.Unlock()
+	}()
+
+	return this.runHooks(ctx, name, hooks, mainPid)
+}
+
+// Returns whether hooks were running.
+func (this *Service) interruptHooks() bool {
+	this.hooksMu.Lock()
+	defer this.hooksMu.Unlock()
+
+	if this.cancelHooks == nil {
+		return false
+	}
+	this.cancelHooks()
+	return true
+}
+
 func (this *Service) startDone() {
+	if this.idle != nil {
+		this.idle.Touch(time.Now())
+	}
 	this.log.Print("started")
 	this.setState(ServiceStateActive)
 }
 
 func (this *Service) stop() error {
+	// The process is stopping already, it's only kept from starting again.
+	if this.pendingRestart != nil {
+		this.pendingRestart <- ServiceErrRestartCanceled
+		this.pendingRestart = nil
+		this.log.Print("restart canceled")
+		return nil
+	}
 	if this.GetState().IsStopped() {
+		if this.cancelRestart() {
+			this.log.Print("automatic restart canceled")
+			return nil
+		}
+		// Won't be started on the next connection anymore.
+		if this.GetState() == ServiceStateIdle {
+			this.stopDone()
+			return nil
+		}
+
 		return ServiceErrAlreadyStopped
 	}
 	this.log.Print("stopping")
@@ -255,8 +962,19 @@ func (this *Service) stop() error {
 }
 
 func (this *Service) stopDone() {
-	this.log.Print("stopped")
-	this.setState(ServiceStateInactive)
+	state := this.stoppedState
+	this.stoppedState = ServiceStateInactive
+
+	switch state {
+	case ServiceStateIdle:
+		this.log.Print("stopped, idle until the next connection")
+		this.setState(ServiceStateIdle)
+	case ServiceStateFailed:
+		this.fail()
+	default:
+		this.log.Print("stopped")
+		this.setState(ServiceStateInactive)
+	}
 }
 
 func (this *Service) reload() error {
@@ -273,6 +991,12 @@ func (this *Service) reload() error {
 	}
 
 	err := this.Watchdog.Reload()
+	if err == nil {
+		pid, _ := this.Pid()
+		err = this.runHooks(
+			context.Background(), "execReloadPost", this.hooks.ReloadPost, pid,
+		)
+	}
 	this.reloadDone()
 	if err != nil {
 		return err
@@ -291,99 +1015,462 @@ func (this *Service) fail() {
 	this.setState(ServiceStateFailed)
 }
 
+func (this *Service) scheduleRestart(exit *ProcExit, failed bool) {
+	if this.restart == nil || !this.restart.ShouldRestart(exit, failed) {
+		return
+	}
+	this.log.Printf("restarting in %s", this.restart.Backoff)
+
+	var timer *time.Timer
+	timer = time.AfterFunc(this.restart.Backoff, func() {
+		this.atomicAction.Lock()
+		defer this.atomicAction.Unlock()
+
+		// Got canceled in the meantime
+		if this.restartTimer != timer {
+			return
+		}
+		this.restartTimer = nil
+
+		err := this.start(ServiceTriggerAutoRestart)
+		if err != nil {
+			this.log.Printf("automatic restart failed: %s", err)
+		}
+	})
+	this.restartTimer = timer
+}
+
+func (this *Service) cancelRestart() bool {
+	if this.restartTimer == nil {
+		return false
+	}
+
+	this.restartTimer.Stop()
+	this.restartTimer = nil
+	return true
+}
+
+func (this *Service) exited(exit *ProcExit, trigger ServiceTrigger) {
+	this.log.Printf("process %s", exit)
+	this.lastExit.Store(exit)
+
+	this.historyMu.Lock()
+	defer this.historyMu.Unlock()
+
+	this.history = append(this.history, ServiceRun{trigger, *exit})
+	if len(this.history) > serviceMaxHistory {
+		this.history = this.history[len(this.history)-serviceMaxHistory:]
+	}
+}
+
+func (this *Service) redact(s string) string {
+	if this.Spec == nil {
+		return s
+	}
+
+	for _, secret := range this.Spec.Secrets {
+		s = secret.Redact(s)
+	}
+	return s
+}
+
+func (this *Service) recordFailure(proc *Proc, exit *ProcExit) {
+	output, err := proc.GetTail()
+	if err != nil {
+		return
+	}
+	for i := range output {
+		output[i].Text = this.redact(output[i].Text)
+	}
+
+	this.failuresMu.Lock()
+	defer this.failuresMu.Unlock()
+
+	this.failures = append(this.failures, ServiceFailure{
+		Time:   exit.StoppedAt,
+		Exit:   *exit,
+		Output: output,
+	})
+	if len(this.failures) > serviceMaxFailures {
+		this.failures = this.failures[len(this.failures)-serviceMaxFailures:]
+	}
+}
+
+// What a service is created with besides its name and watchdog, the zero
+// value is a service without any of the optional features.
+type ServiceOptions struct {
+	Replica   int
+	Spec      *ServiceSpec
+	LogStdout bool
+	LogStderr bool
+	Sinks     []LogSink
+	Limiter   *LogRateLimiter
+	Restart   *RestartPolicy
+	// Whether restarts start the new process before stopping the running one.
+	StartFirst bool
+	MinReady   time.Duration
+	Sockets    *SocketActivation
+	FdStore    *FdStore
+	Idle       *IdleMonitor
+	Hooks      *ServiceHooks
+	Cgroup     *Cgroup
+}
+
 func NewService(
-	name string,
-	watchdog Watchdog,
-	logStdout, logStderr bool,
+	name string, watchdog Watchdog, opts ServiceOptions,
 ) *Service {
+	r, w := io.Pipe()
+	hooks := opts.Hooks
+	if hooks == nil {
+		hooks = &ServiceHooks{}
+	}
+
 	return &Service{
 		Name:     name,
+		Replica:  opts.Replica,
 		Watchdog: watchdog,
+		Spec:     opts.Spec,
 
 		logB:      NewBroadcaster(),
-		logStdout: logStdout,
-		logStderr: logStderr,
-		log:       nil,
+		logW:      w,
+		logR:      r,
+		stdoutB:   NewBroadcaster(),
+		stderrB:   NewBroadcaster(),
+		logStdout: opts.LogStdout,
+		logStderr: opts.LogStderr,
+		log:       log.New(w, "", 0),
+		sinks:     opts.Sinks,
+		limiter:   opts.Limiter,
+		cgroup:    opts.Cgroup,
+		sockets:   opts.Sockets,
+		fdStore:   opts.FdStore,
+		idle:      opts.Idle,
+		hooks:     hooks,
 
 		running: atomic.Bool{},
 		state:   atomic.Int32{},
 		bus:     pubsub.New[int, ServiceState](0),
 
+		failuresMu: sync.Mutex{},
+		failures:   make([]ServiceFailure, 0),
+
+		historyMu: sync.Mutex{},
+		history:   make([]ServiceRun, 0),
+
+		restart:        opts.Restart,
+		startFirst:     opts.StartFirst,
+		minReady:       opts.MinReady,
+		restartTimer:   nil,
+		pendingRestart: nil,
+		stoppedState:   ServiceStateInactive,
+		hooksMu:        sync.Mutex{},
+		cancelHooks:    nil,
+
 		atomicAction: sync.Mutex{},
 	}
 }
 
-func NewServiceFromConfig(cfg *config.Service) (*Service, error) {
-	parts, err := ParseCommandLine(string(cfg.Process.Exec))
+// Processes of the service are spawned into a cgroup under cgroupRoot, nil
+// when cgroups are unavailable. Replica is the number of the replica cfg is,
+// see config.Service.GetReplica, or 0.
+func NewServiceFromConfig(
+	cfg *config.Service, replica int, root *config.Config,
+	cgroupRoot *CgroupRoot,
+) (*Service, error) {
+	uid, err := cfg.Process.GetUid()
 	if err != nil {
 		return nil, err
 	}
-	stopCfg, err := cfg.Process.GetStop()
+	gid, err := cfg.Process.GetGid()
 	if err != nil {
 		return nil, err
 	}
-	stop, err := NewStopProcActionFromConfig(stopCfg)
+	builtins := cfg.GetVars(replica)
+	env, err := cfg.Process.GetEnv(builtins)
 	if err != nil {
 		return nil, err
 	}
-	reloadCfg, err := cfg.Process.GetReload()
+	groups, err := cfg.Process.GetSupplementaryGroups()
 	if err != nil {
 		return nil, err
 	}
-	reload, err := NewReloadProcActionFromConfig(reloadCfg)
+	attr, err := NewProcAttrFromConfig(&cfg.Process)
 	if err != nil {
 		return nil, err
 	}
-
-	uid, err := cfg.Process.GetUid()
+	dirs, err := NewProcDirsFromConfig(&cfg.Process)
 	if err != nil {
 		return nil, err
 	}
-	gid, err := cfg.Process.GetGid()
+	for _, dir := range dirs {
+		env = append(env, dir.EnvVar())
+	}
+	env = append(env, cfg.GetBuiltinEnv(replica)...)
+	vars := config.NewVars(builtins, env)
+	secretsCfg, err := cfg.Process.GetSecretEnv(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	parts, err := ParseCommandLine(string(cfg.Process.Exec))
 	if err != nil {
 		return nil, err
 	}
-	env, err := cfg.Process.GetEnv()
+	parts, err = config.InterpolateAll(parts, vars)
+	if err != nil {
+		return nil, fmt.Errorf("exec: %w", err)
+	}
+	cwd, err := config.Interpolate(string(cfg.Process.Cwd), vars)
+	if err != nil {
+		return nil, fmt.Errorf("cwd: %w", err)
+	}
+	stdinPath, err := cfg.Process.GetStdinPath(vars)
+	if err != nil {
+		return nil, fmt.Errorf("stdin: %w", err)
+	}
+
+	controls, err := NewCgroupControlsFromConfig(cfg.Resources)
 	if err != nil {
 		return nil, err
 	}
+	var cgroup *Cgroup = nil
+	if cgroupRoot != nil {
+		supported := make([]CgroupControl, 0)
+		for _, c := range controls {
+			if !cgroupRoot.HasController(c.Controller()) {
+				fmt.Printf(
+					"warning: %s: ignoring %s, %s controller unavailable\n",
+					cfg.Name, c.File, c.Controller(),
+				)
+				continue
+			}
+			supported = append(supported, c)
+		}
+		cgroup = cgroupRoot.Service(cfg.Name, supported)
+	}
 
-	createProc := func(path string, args ...string) *Proc {
+	// Commands of the secrets share everything with the process, except for
+	// the cgroup and directories which belong to the process, and the secrets.
+	createSecretProc := func(path string, args ...string) *Proc {
 		proc := NewProc(path, args...)
 
-		proc.Cwd = string(cfg.Process.Cwd)
+		proc.Cwd = cwd
 		proc.Uid = uid
 		proc.Gid = gid
+		proc.Groups = groups
 		proc.Env = env
+		proc.Attr = attr
 
 		return proc
 	}
-	exec := func() (*Proc, error) {
-		stdin, err := cfg.Process.GetStdin()
+	secrets := make([]*EnvSecret, 0)
+	for _, c := range secretsCfg {
+		secret, err := NewEnvSecretFromConfig(c, createSecretProc, vars, uid)
+		if err != nil {
+			return nil, fmt.Errorf("environment variable %s: %w", c.Key, err)
+		}
+		secrets = append(secrets, secret)
+	}
+	// Read for every process the service spawns.
+	secretEnv := func() ([]string, error) {
+		vars := make([]string, 0, len(secrets))
+		for _, secret := range secrets {
+			e, err := secret.EnvVar()
+			if err != nil {
+				return nil, err
+			}
+			vars = append(vars, e)
+		}
+
+		return vars, nil
+	}
+	// Commands of the actions and the hooks get the secrets as well.
+	createActionProc := func(path string, args ...string) *Proc {
+		proc := createSecretProc(path, args...)
+		if len(secrets) != 0 {
+			proc.EnvFunc = secretEnv
+		}
+
+		return proc
+	}
+	createProc := func(path string, args ...string) *Proc {
+		proc := createActionProc(path, args...)
+
+		proc.TailLines = cfg.FailureLogLines
+		proc.Cgroup = cgroup
+		proc.Dirs = dirs
+
+		return proc
+	}
+	var sockets *SocketActivation = nil
+	if len(cfg.Sockets) != 0 {
+		sockets, err = NewSocketActivationFromConfig(cfg, vars)
+		if err != nil {
+			return nil, fmt.Errorf("sockets: %w", err)
+		}
+	}
+	var fdStore *FdStore = nil
+	if cfg.FileDescriptorStoreMax != 0 {
+		fdStore = NewFdStoreFromConfig(cfg, uid, gid)
+	}
+	var idle *IdleMonitor = nil
+	if cfg.IdleTimeout != nil {
+		idle, err = NewIdleMonitorFromConfig(cfg, sockets)
 		if err != nil {
 			return nil, err
 		}
+	}
+	exec := func() (*Proc, error) {
 		proc := createProc(parts[0], parts[1:]...)
-		if stdin != nil {
+		// Read right away rather than when spawning, so the start fails when
+		// a secret can't be read.
+		if len(secrets) != 0 {
+			e, err := secretEnv()
+			if err != nil {
+				return nil, err
+			}
+			proc.EnvFunc = nil
+			proc.Env = append(slices.Clone(env), e...)
+		}
+		// Stored file descriptors are passed after the sockets, the same as
+		// systemd does.
+		files, names := make([]*os.File, 0), make([]string, 0)
+		if sockets != nil {
+			f, err := sockets.Files()
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, f...)
+			names = append(names, sockets.Names()...)
+		}
+		if fdStore != nil {
+			err := fdStore.Open()
+			if err != nil {
+				return nil, fmt.Errorf("notify socket: %w", err)
+			}
+			proc.Env = append(slices.Clone(proc.Env), fdStore.EnvVar())
+			f, n := fdStore.Files()
+			files = append(files, f...)
+			names = append(names, n...)
+		}
+		if len(files) != 0 {
+			proc.ExtraFiles = files
+			proc.Env = append(slices.Clone(proc.Env), listenEnv(names)...)
+			attr := *proc.Attr
+			attr.ListenPid = true
+			proc.Attr = &attr
+		}
+		if stdinPath != "" {
+			stdin, err := os.Open(stdinPath)
+			if err != nil {
+				return nil, err
+			}
 			proc.Stdin = stdin
 		}
 
 		return proc, nil
 	}
 
+	stopCfg, err := cfg.Process.GetStop()
+	if err != nil {
+		return nil, err
+	}
+	stop, err := NewStopProcActionFromConfig(stopCfg, createActionProc, vars)
+	if err != nil {
+		return nil, fmt.Errorf("stop: %w", err)
+	}
+	hooks, err := NewServiceHooksFromConfig(
+		&cfg.Process, createActionProc, vars,
+	)
+	if err != nil {
+		return nil, err
+	}
+	reloadCfg, err := cfg.Process.GetReload()
+	if err != nil {
+		return nil, err
+	}
+	reload, err := NewReloadProcActionFromConfig(
+		reloadCfg, createActionProc, vars,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("reload: %w", err)
+	}
+
 	// TODO: handle empty watchdog, target files you know...
 	wdCfg, err := cfg.Process.GetWatchdog()
 	if err != nil {
 		return nil, err
 	}
-	wd, err := NewWatchdogFromConfig(wdCfg, exec, stop, reload)
+	successCfg, err := cfg.GetSuccessExitStatus()
+	if err != nil {
+		return nil, err
+	}
+	success, err := NewExitStatusSetFromConfig(successCfg)
+	if err != nil {
+		return nil, err
+	}
+	wd, err := NewWatchdogFromConfig(wdCfg, exec, stop, reload, success)
+	if err != nil {
+		return nil, err
+	}
+	restart, err := NewRestartPolicyFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	minReady, err := time.ParseDuration(string(cfg.MinReady))
+	if err != nil {
+		return nil, fmt.Errorf("minReady: %w", err)
+	}
+
+	globalSinks, err := root.GetLogSinks()
+	if err != nil {
+		return nil, err
+	}
+	sinksCfg, err := cfg.GetLogSinks(globalSinks)
 	if err != nil {
 		return nil, err
 	}
+	sinks := make([]LogSink, 0)
+	for _, sinkCfg := range sinksCfg {
+		sink, err := NewLogSinkFromConfig(sinkCfg)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	var limiter *LogRateLimiter = nil
+	if cfg.LogRateLimit != nil {
+		limiter, err = NewLogRateLimiterFromConfig(cfg.LogRateLimit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	spec := &ServiceSpec{
+		Args:    parts,
+		Cwd:     cwd,
+		Uid:     uid,
+		Gid:     gid,
+		Env:     env,
+		Secrets: secrets,
+	}
 
-	return NewService(
-		cfg.Name, wd,
+	return NewService(cfg.Name, wd, ServiceOptions{
+		Replica: replica,
+		Spec:    spec,
 		// TODO: handle target files...
-		bool(cfg.Process.Stdout), bool(cfg.Process.Stderr),
-	), nil
+		LogStdout:  bool(cfg.Process.Stdout),
+		LogStderr:  bool(cfg.Process.Stderr),
+		Sinks:      sinks,
+		Limiter:    limiter,
+		Restart:    restart,
+		StartFirst: cfg.RestartMode == config.ServiceRestartModeStartFirst,
+		MinReady:   minReady,
+		Sockets:    sockets,
+		FdStore:    fdStore,
+		Idle:       idle,
+		Hooks:      hooks,
+		Cgroup:     cgroup,
+	}), nil
 }
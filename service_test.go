@@ -0,0 +1,339 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/thekhanj/ella/config"
+)
+
+// Returns a running service whose process runs the shell script.
+func newTestService(
+	ctx context.Context, script string, opts ServiceOptions,
+) *Service {
+	exec := func() (*Proc, error) {
+		return NewProc("sh", "-c", script), nil
+	}
+	watchdog := NewSimpleWatchdog(
+		exec,
+		&StopSignalProcAction{timeout: time.Second, signal: syscall.SIGTERM},
+		&ReloadSignalProcAction{signal: syscall.SIGHUP},
+		nil,
+	)
+	s := NewService("app", watchdog, opts)
+	go s.Run(ctx)
+
+	return s
+}
+
+// Creates the service of the config, without running it.
+func newServiceFromJSON(t *testing.T, service string) *Service {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "ella.json")
+	err := os.WriteFile(path, []byte(`{"services": [`+service+`]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg config.Config
+	err = config.ReadParsedConfig(path, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServiceFromConfig(&cfg.Services[0], 0, &cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func waitActive(t *testing.T, ctx context.Context, s *Service) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := s.WaitState(ctx, func(state ServiceState) bool {
+		return state == ServiceStateActive
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServiceRestart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hooks := &ServiceHooks{
+		StopPost: []*Hook{newTestHook(t, "sleep 0.3", time.Second)},
+	}
+	s := newTestService(ctx, "exec sleep 10", ServiceOptions{Hooks: hooks})
+
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitActive(t, ctx, s)
+	pid, err := s.Pid()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := make(chan error)
+	go func() {
+		restarted <- s.Restart()
+	}()
+	// Comes in while execStopPost runs, the restart isn't interrupted.
+	time.Sleep(100 * time.Millisecond)
+	err = s.Start()
+	if !errors.Is(err, ServiceErrAlreadyRunning) {
+		t.Fatalf("expected the restart to start the service, got: %v", err)
+	}
+	err = <-restarted
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitActive(t, ctx, s)
+	newPid, err := s.Pid()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newPid == pid {
+		t.Fatal("expected a new process")
+	}
+}
+
+func TestServiceRestartStartFirst(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	minReady := 300 * time.Millisecond
+	s := newTestService(ctx, "exec sleep 10", ServiceOptions{
+		StartFirst: true,
+		MinReady:   minReady,
+	})
+
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitActive(t, ctx, s)
+	pid, err := s.Pid()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	err = s.Restart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < minReady {
+		t.Fatalf("expected the restart to wait for %s, took %s", minReady, elapsed)
+	}
+	if state := s.GetState(); state != ServiceStateActive {
+		t.Fatalf("expected the service to stay active, got: %s", state.Name())
+	}
+	newPid, err := s.Pid()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newPid == pid {
+		t.Fatal("expected a new process")
+	}
+}
+
+func TestServiceRestartStartFirstRolledBack(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Only the first process keeps running.
+	marker := filepath.Join(t.TempDir(), "marker")
+	s := newTestService(
+		ctx, "[ -f "+marker+" ] && exit 3; touch "+marker+"; exec sleep 10",
+		ServiceOptions{StartFirst: true, MinReady: time.Second},
+	)
+
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	waitActive(t, ctx, s)
+	for range 50 {
+		if _, err := os.Stat(marker); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	pid, err := s.Pid()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Restart()
+	if !errors.Is(err, WatchdogErrRolledBack) {
+		t.Fatalf("expected the restart to be rolled back, got: %v", err)
+	}
+	if newPid, _ := s.Pid(); newPid != pid {
+		t.Fatal("expected the running process to be kept")
+	}
+
+	// The exit of the new process is reported asynchronously.
+	for range 50 {
+		if len(s.Failures()) != 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	failures := s.Failures()
+	if len(failures) != 1 || failures[0].Exit.Code != 3 {
+		t.Fatalf("expected the rolled back process to be a failure: %+v", failures)
+	}
+	history := s.History()
+	if len(history) != 1 || history[0].Trigger != ServiceTriggerRestart ||
+		history[0].Exit.Code != 3 {
+		t.Fatalf("expected the rolled back process in the history: %+v", history)
+	}
+	if state := s.GetState(); state != ServiceStateActive {
+		t.Fatalf("expected the service to stay active, got: %s", state.Name())
+	}
+}
+
+func TestServiceSecretsForEveryProcess(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	err := os.WriteFile(secret, []byte("hunter2\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServiceFromJSON(t, `{
+		"name": "app",
+		"process": {
+			"exec": "sh -c 'echo $TOKEN > `+dir+`/main; exec sleep 10'",
+			"user": "!inherit",
+			"environments": {"TOKEN": {"type": "file", "path": "`+secret+`"}},
+			"reload": {"type": "exec", "exec": "sh -c 'echo $TOKEN > `+dir+`/reload'", "timeout": "5s"},
+			"execStartPost": [{"exec": "sh -c 'echo $TOKEN > `+dir+`/post'"}]
+		},
+		"restart": {"strategy": "never"}
+	}`)
+	go s.Run(ctx)
+
+	err = s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitActive(t, ctx, s)
+	err = s.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	// The main process writes its file asynchronously.
+	for _, name := range []string{"main", "post", "reload"} {
+		var b []byte
+		for range 50 {
+			b, err = os.ReadFile(filepath.Join(dir, name))
+			if err == nil && len(b) != 0 {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(string(b)) != "hunter2" {
+			t.Errorf("%s: expected the secret, got: %q", name, b)
+		}
+	}
+}
+
+func TestServiceHistory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := newTestService(ctx, "exec sleep 10", ServiceOptions{})
+	if n := len(s.History()); n != 0 {
+		t.Fatalf("expected no history, got %d runs", n)
+	}
+
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitActive(t, ctx, s)
+	pid, err := s.Pid()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Restart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitActive(t, ctx, s)
+	err = s.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.WaitState(ctx, ServiceState.IsStopped)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history := s.History()
+	if len(history) != 2 {
+		t.Fatalf("expected 2 runs, got %d", len(history))
+	}
+	if history[0].Trigger != ServiceTriggerStart || history[0].Exit.Pid != pid {
+		t.Fatalf("unexpected first run: %+v", history[0])
+	}
+	if history[1].Trigger != ServiceTriggerRestart ||
+		history[1].Exit.Signal != syscall.SIGTERM {
+		t.Fatalf("unexpected second run: %+v", history[1])
+	}
+	if !history[1].Exit.StartedAt.After(history[0].Exit.StartedAt) {
+		t.Fatal("expected the runs to be in order")
+	}
+
+	// The returned history is a copy.
+	history[0].Trigger = ServiceTriggerSocket
+	if s.History()[0].Trigger != ServiceTriggerStart {
+		t.Fatal("expected the history not to be modified")
+	}
+}
+
+func TestServiceHistoryLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Running, as the runs get logged.
+	s := newTestService(ctx, "exec sleep 10", ServiceOptions{})
+	for i := range serviceMaxHistory + 5 {
+		s.exited(&ProcExit{Pid: i}, ServiceTriggerAutoRestart)
+	}
+
+	history := s.History()
+	if len(history) != serviceMaxHistory {
+		t.Fatalf("expected %d runs, got %d", serviceMaxHistory, len(history))
+	}
+	if history[0].Exit.Pid != 5 {
+		t.Fatalf("expected the oldest runs to be dropped, got pid %d", history[0].Exit.Pid)
+	}
+}
@@ -6,22 +6,30 @@ package main
 import (
 	"bufio"
 	"context"
+	"flag"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/google/shlex"
 	"github.com/thekhanj/ella/common"
 )
 
 type SocketServer struct {
-	getService func(name string) (*Service, error)
-	services   []*Service
+	// Returns all the replicas for a service with replicas.
+	lookupServices func(name string) ([]*Service, error)
+	// Like lookupServices, but creates instances e.g. worker@eu which haven't
+	// been started yet.
+	instantiate  func(name string) ([]*Service, error)
+	listServices func() []*Service
+	scale        func(name string, n int) error
 }
 
 func (this *SocketServer) Listen(ctx context.Context) error {
@@ -70,7 +78,13 @@ func (this *SocketServer) handleCommand(w io.Writer, cmdLine string) {
 
 	handlers := []func(io.Writer, string, []string) (error, bool){
 		this.handleLogsCommand,
+		this.handleFailuresCommand,
+		this.handleHistoryCommand,
+		this.handleStatusCommand,
+		this.handleShowCommand,
 		this.handleServicesCommand,
+		this.handleScaleCommand,
+		this.handleRollingRestartCommand,
 		this.handleListCommand,
 	}
 
@@ -100,7 +114,7 @@ func (this *SocketServer) handleListCommand(
 		return fmt.Errorf("extra argument: %s", extraArgs[0]), true
 	}
 
-	for _, s := range this.services {
+	for _, s := range this.listServices() {
 		fmt.Fprintln(w, s.Name)
 	}
 	return nil, true
@@ -121,9 +135,65 @@ func (this *SocketServer) handleServicesCommand(
 		return nil, false
 	}
 
+	// Only starting a service creates an instance, a lookup e.g. for a typo
+	// would create one otherwise.
+	if cmd == "start" {
+		for _, name := range services {
+			_, err := this.instantiate(name)
+			if err != nil {
+				return err, true
+			}
+		}
+	}
+
 	return this.runServicesAction(w, services, fn), true
 }
 
+func (this *SocketServer) handleScaleCommand(
+	w io.Writer, cmd string, args []string,
+) (error, bool) {
+	if cmd != "scale" {
+		return nil, false
+	}
+
+	if len(args) != 2 {
+		return fmt.Errorf("expected a service and a number of replicas"), true
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid number of replicas: %s", args[1]), true
+	}
+
+	return this.scale(args[0], n), true
+}
+
+func (this *SocketServer) handleRollingRestartCommand(
+	w io.Writer, cmd string, args []string,
+) (error, bool) {
+	if cmd != "rolling-restart" {
+		return nil, false
+	}
+
+	f := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	f.SetOutput(io.Discard)
+	maxUnavailable := f.Int("max-unavailable", rollingRestartMaxUnavailable, "")
+	timeout := f.Duration("ready-timeout", rollingRestartReadyTimeout, "")
+	minReady := f.Duration("min-ready", rollingRestartMinReady, "")
+	err := f.Parse(args)
+	if err != nil {
+		return err, true
+	}
+
+	services, err := this.getServices(f.Args())
+	if err != nil {
+		return err, true
+	}
+
+	return RollingRestart(
+		w, services, *maxUnavailable, *timeout, *minReady,
+	), true
+}
+
 func (this *SocketServer) handleLogsCommand(
 	w io.Writer, cmd string, services []string,
 ) (error, bool) {
@@ -134,6 +204,46 @@ func (this *SocketServer) handleLogsCommand(
 	return this.showLogs(w, services), true
 }
 
+func (this *SocketServer) handleFailuresCommand(
+	w io.Writer, cmd string, services []string,
+) (error, bool) {
+	if cmd != "failures" {
+		return nil, false
+	}
+
+	return this.showFailures(w, services), true
+}
+
+func (this *SocketServer) handleHistoryCommand(
+	w io.Writer, cmd string, services []string,
+) (error, bool) {
+	if cmd != "history" {
+		return nil, false
+	}
+
+	return this.showHistory(w, services), true
+}
+
+func (this *SocketServer) handleStatusCommand(
+	w io.Writer, cmd string, services []string,
+) (error, bool) {
+	if cmd != "status" {
+		return nil, false
+	}
+
+	return this.showStatus(w, services), true
+}
+
+func (this *SocketServer) handleShowCommand(
+	w io.Writer, cmd string, services []string,
+) (error, bool) {
+	if cmd != "show" {
+		return nil, false
+	}
+
+	return this.showSpecs(w, services), true
+}
+
 func (this *SocketServer) runServicesAction(
 	w io.Writer, services []string,
 	actionFn func(s *Service) error,
@@ -178,16 +288,137 @@ func (this *SocketServer) showLogs(
 	return err
 }
 
+func (this *SocketServer) showStatus(
+	w io.Writer, serviceNames []string,
+) error {
+	services, err := this.getServices(serviceNames)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range services {
+		state := s.GetState().Name()
+		if pid, err := s.Pid(); err == nil {
+			fmt.Fprintf(w, "%s: %s (pid %d)\n", s.Name, state, pid)
+		} else {
+			fmt.Fprintf(w, "%s: %s\n", s.Name, state)
+		}
+
+		if exit := s.LastExit(); exit != nil {
+			fmt.Fprintf(
+				w, "  last exit: %s at %s\n",
+				exit, exit.StoppedAt.Format(time.RFC3339),
+			)
+			fmt.Fprintf(w, "  %s\n", exit.Usage())
+		}
+		if stats, err := s.CgroupStats(); err == nil {
+			fmt.Fprintf(w, "  cgroup: %s\n", stats)
+		}
+	}
+
+	return nil
+}
+
+func (this *SocketServer) showSpecs(
+	w io.Writer, serviceNames []string,
+) error {
+	services, err := this.getServices(serviceNames)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range services {
+		fmt.Fprintf(w, "%s:\n", s.Name)
+		if s.Spec == nil {
+			continue
+		}
+
+		fmt.Fprintf(w, "  exec: %s\n", s.redact(strings.Join(s.Spec.Args, " ")))
+		if s.Spec.Cwd != "" {
+			fmt.Fprintf(w, "  cwd: %s\n", s.Spec.Cwd)
+		}
+		fmt.Fprintf(w, "  user: %d, group: %d\n", s.Spec.Uid, s.Spec.Gid)
+		for _, e := range s.Spec.Env {
+			fmt.Fprintf(w, "  env: %s\n", s.redact(e))
+		}
+		for _, secret := range s.Spec.Secrets {
+			fmt.Fprintf(
+				w, "  env: %s=%s (%s)\n",
+				secret.Name, secretRedacted, secret.Source(),
+			)
+		}
+	}
+
+	return nil
+}
+
+func (this *SocketServer) showFailures(
+	w io.Writer, serviceNames []string,
+) error {
+	services, err := this.getServices(serviceNames)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range services {
+		failures := s.Failures()
+		if len(failures) == 0 {
+			fmt.Fprintf(w, "%s: no failures\n", s.Name)
+			continue
+		}
+
+		for _, f := range failures {
+			fmt.Fprintf(
+				w, "%s: failed at %s: %s\n",
+				s.Name, f.Time.Format(time.RFC3339), &f.Exit,
+			)
+			for _, line := range f.Output {
+				fmt.Fprintf(w, "  %s\n", PlainLogFormatter{}.Format(s.Name, line))
+			}
+		}
+	}
+
+	return nil
+}
+
+func (this *SocketServer) showHistory(
+	w io.Writer, serviceNames []string,
+) error {
+	services, err := this.getServices(serviceNames)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range services {
+		history := s.History()
+		if len(history) == 0 {
+			fmt.Fprintf(w, "%s: no history\n", s.Name)
+			continue
+		}
+
+		for _, r := range history {
+			fmt.Fprintf(
+				w, "%s: pid %d started at %s by %s, %s at %s\n",
+				s.Name, r.Exit.Pid,
+				r.Exit.StartedAt.Format(time.RFC3339), r.Trigger.Name(),
+				&r.Exit, r.Exit.StoppedAt.Format(time.RFC3339),
+			)
+		}
+	}
+
+	return nil
+}
+
 func (this *SocketServer) getServices(
 	services []string,
 ) ([]*Service, error) {
 	ss := make([]*Service, 0)
 	for _, name := range services {
-		s, err := this.getService(name)
+		found, err := this.lookupServices(name)
 		if err != nil {
 			return nil, err
 		}
-		ss = append(ss, s)
+		ss = append(ss, found...)
 	}
 
 	return ss, nil
@@ -0,0 +1,288 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/thekhanj/ella/config"
+)
+
+// A socket ella listens on for a service, passed to its processes.
+type ServiceSocket struct {
+	Name    string
+	Type    config.SocketType
+	Address string
+	// Mode and owner of the socket file of a unix socket, nil keeps the
+	// owner of the main process.
+	Mode os.FileMode
+	Uid  *uint32
+	Gid  *uint32
+
+	file *os.File
+}
+
+func (this *ServiceSocket) open() error {
+	var l interface {
+		io.Closer
+		File() (*os.File, error)
+	}
+	var err error
+	switch this.Type {
+	case config.SocketTypeTcp:
+		var addr *net.TCPAddr
+		addr, err = net.ResolveTCPAddr("tcp", this.Address)
+		if err == nil {
+			l, err = net.ListenTCP("tcp", addr)
+		}
+	case config.SocketTypeUdp:
+		var addr *net.UDPAddr
+		addr, err = net.ResolveUDPAddr("udp", this.Address)
+		if err == nil {
+			l, err = net.ListenUDP("udp", addr)
+		}
+	case config.SocketTypeUnix:
+		l, err = this.listenUnix()
+	default:
+		err = fmt.Errorf("invalid socket type: %s", this.Type)
+	}
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	// The listener is only needed to create the socket, the processes get a
+	// duplicate of it.
+	file, err := l.File()
+	if err != nil {
+		return err
+	}
+	this.file = file
+
+	return nil
+}
+
+func (this *ServiceSocket) listenUnix() (*net.UnixListener, error) {
+	// Left behind by a previous run of the daemon which didn't exit cleanly.
+	info, err := os.Lstat(this.Address)
+	if err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(this.Address)
+	}
+
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: this.Address, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	l.SetUnlinkOnClose(false)
+
+	err = os.Chmod(this.Address, this.Mode)
+	if err == nil && (this.Uid != nil || this.Gid != nil) {
+		uid, gid := -1, -1
+		if this.Uid != nil {
+			uid = int(*this.Uid)
+		}
+		if this.Gid != nil {
+			gid = int(*this.Gid)
+		}
+		err = os.Lchown(this.Address, uid, gid)
+	}
+	if err != nil {
+		l.Close()
+		os.Remove(this.Address)
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (this *ServiceSocket) close() error {
+	if this.file == nil {
+		return nil
+	}
+
+	err := this.file.Close()
+	this.file = nil
+	if this.Type == config.SocketTypeUnix {
+		err = errors.Join(err, os.Remove(this.Address))
+	}
+
+	return err
+}
+
+// Sockets of a service, they're opened once and stay open across the runs
+// of its processes, see sd_listen_fds(3).
+type SocketActivation struct {
+	Sockets []*ServiceSocket
+	// Whether the service gets started on the first connection once it's
+	// inactive.
+	Lazy bool
+
+	mu sync.Mutex
+}
+
+// Opens the sockets which aren't open yet.
+func (this *SocketActivation) Open() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	return this.open()
+}
+
+// The caller must hold the lock.
+func (this *SocketActivation) open() error {
+	for _, s := range this.Sockets {
+		if s.file != nil {
+			continue
+		}
+
+		err := s.open()
+		if err != nil {
+			return fmt.Errorf("%s socket %s: %w", s.Type, s.Address, err)
+		}
+	}
+
+	return nil
+}
+
+func (this *SocketActivation) Close() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	errs := make([]error, 0)
+	for _, s := range this.Sockets {
+		errs = append(errs, s.close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// Returns the files of the sockets in order, opening them when they aren't
+// open yet.
+func (this *SocketActivation) Files() ([]*os.File, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	err := this.open()
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]*os.File, 0, len(this.Sockets))
+	for _, s := range this.Sockets {
+		files = append(files, s.file)
+	}
+
+	return files, nil
+}
+
+func (this *SocketActivation) Names() []string {
+	names := make([]string, 0, len(this.Sockets))
+	for _, s := range this.Sockets {
+		names = append(names, s.Name)
+	}
+
+	return names
+}
+
+// LISTEN_FDS and LISTEN_FDNAMES of the files passed to a process with the
+// given names, LISTEN_PID is set by the exec helper as the pid is only known
+// once the process is spawned.
+func listenEnv(names []string) []string {
+	return []string{
+		fmt.Sprintf("LISTEN_FDS=%d", len(names)),
+		"LISTEN_FDNAMES=" + strings.Join(names, ":"),
+	}
+}
+
+// Waits for a connection, or a datagram, on one of the sockets without
+// accepting it.
+func (this *SocketActivation) Wait(ctx context.Context) error {
+	files, err := this.Files()
+	if err != nil {
+		return err
+	}
+
+	return waitReadable(ctx, files)
+}
+
+// Counts the open connections to the tcp and unix sockets.
+func (this *SocketActivation) Connections() (int, error) {
+	this.mu.Lock()
+	ports, paths := make([]int, 0), make([]string, 0)
+	for _, s := range this.Sockets {
+		if s.file == nil {
+			continue
+		}
+
+		switch s.Type {
+		case config.SocketTypeTcp:
+			sa, err := syscall.Getsockname(int(s.file.Fd()))
+			if err != nil {
+				this.mu.Unlock()
+				return 0, err
+			}
+			switch sa := sa.(type) {
+			case *syscall.SockaddrInet4:
+				ports = append(ports, sa.Port)
+			case *syscall.SockaddrInet6:
+				ports = append(ports, sa.Port)
+			}
+		case config.SocketTypeUnix:
+			paths = append(paths, s.Address)
+		}
+	}
+	this.mu.Unlock()
+
+	return countConnections(ports, paths)
+}
+
+func NewSocketActivationFromConfig(
+	cfg *config.Service, vars config.Vars,
+) (*SocketActivation, error) {
+	sockets := make([]*ServiceSocket, 0)
+	for _, c := range cfg.Sockets {
+		address, err := config.Interpolate(c.Address, vars)
+		if err != nil {
+			return nil, fmt.Errorf("address: %w", err)
+		}
+		mode, err := c.GetMode()
+		if err != nil {
+			return nil, err
+		}
+		uid, err := c.GetUid()
+		if err != nil {
+			return nil, err
+		}
+		gid, err := c.GetGid()
+		if err != nil {
+			return nil, err
+		}
+
+		sockets = append(sockets, &ServiceSocket{
+			Name:    c.GetName(cfg.Name),
+			Type:    c.Type,
+			Address: address,
+			Mode:    mode,
+			Uid:     uid,
+			Gid:     gid,
+
+			file: nil,
+		})
+	}
+
+	return &SocketActivation{
+		Sockets: sockets,
+		Lazy:    cfg.Lazy,
+
+		mu: sync.Mutex{},
+	}, nil
+}
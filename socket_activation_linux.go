@@ -0,0 +1,136 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// States of the connections in /proc/net, see include/net/tcp_states.h and
+// include/uapi/linux/net.h.
+const (
+	procNetTcpEstablished = "01"
+	procNetUnixConnected  = "03"
+)
+
+// Waits for one of the files to become readable, a pipe written to on
+// cancellation of the context wakes the wait up.
+func waitReadable(ctx context.Context, files []*os.File) error {
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(epfd)
+
+	var wake [2]int
+	err = syscall.Pipe2(wake[:], syscall.O_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(wake[0])
+	defer syscall.Close(wake[1])
+
+	fds := []int{wake[0]}
+	for _, f := range files {
+		fds = append(fds, int(f.Fd()))
+	}
+	for _, fd := range fds {
+		event := syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(fd)}
+		err := syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, fd, &event)
+		if err != nil {
+			return err
+		}
+	}
+
+	woken := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		defer close(woken)
+		syscall.Write(wake[1], []byte{0})
+	})
+	defer func() {
+		// The pipe must outlive the write.
+		if !stop() {
+			<-woken
+		}
+	}()
+
+	events := make([]syscall.EpollEvent, len(fds))
+	for {
+		n, err := syscall.EpollWait(epfd, events, -1)
+		if errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if n > 0 {
+			return nil
+		}
+	}
+}
+
+// Counts the established connections to the tcp ports and the unix socket
+// paths, in the network namespace of the daemon which the sockets belong to.
+func countConnections(ports []int, paths []string) (int, error) {
+	count := 0
+	for _, name := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		err := readProcNet(name, func(fields []string) {
+			if len(fields) < 4 || fields[3] != procNetTcpEstablished {
+				return
+			}
+			_, hex, _ := strings.Cut(fields[1], ":")
+			port, err := strconv.ParseInt(hex, 16, 32)
+			if err == nil && slices.Contains(ports, int(port)) {
+				count++
+			}
+		})
+		// No ipv6 support.
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return 0, err
+		}
+	}
+
+	err := readProcNet("/proc/net/unix", func(fields []string) {
+		if len(fields) < 8 || fields[5] != procNetUnixConnected {
+			return
+		}
+		if slices.Contains(paths, fields[7]) {
+			count++
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Calls fn with the fields of each line but the header.
+func readProcNet(name string, fn func(fields []string)) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan()
+	for scanner.Scan() {
+		fn(strings.Fields(scanner.Text()))
+	}
+
+	return scanner.Err()
+}
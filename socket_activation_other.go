@@ -0,0 +1,20 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+)
+
+func waitReadable(ctx context.Context, files []*os.File) error {
+	return errors.New("lazy start is only supported on linux")
+}
+
+func countConnections(ports []int, paths []string) (int, error) {
+	return 0, errors.New("counting connections is only supported on linux")
+}
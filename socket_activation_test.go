@@ -0,0 +1,97 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/thekhanj/ella/config"
+)
+
+func TestSocketActivation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.sock")
+	sockets := &SocketActivation{
+		Sockets: []*ServiceSocket{
+			{Name: "http", Type: config.SocketTypeTcp, Address: "127.0.0.1:0"},
+			{Name: "app", Type: config.SocketTypeUnix, Address: path, Mode: 0600},
+		},
+		Lazy: true,
+	}
+	defer sockets.Close()
+
+	files, err := sockets.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got: %d", len(files))
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("unexpected mode of the socket file: %s", info.Mode())
+	}
+	env := []string{"LISTEN_FDS=2", "LISTEN_FDNAMES=http:app"}
+	if got := listenEnv(sockets.Names()); !slices.Equal(got, env) {
+		t.Fatalf("unexpected env: %v", got)
+	}
+
+	l, err := net.FileListener(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	waited := make(chan error)
+	go func() {
+		waited <- sockets.Wait(context.Background())
+	}()
+	select {
+	case err := <-waited:
+		t.Fatalf("expected to wait for a connection, got: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := <-waited; err != nil {
+		t.Fatal(err)
+	}
+
+	// The connection is left to the process.
+	if err := sockets.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	accepted, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = sockets.Wait(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected the wait to be canceled, got: %v", err)
+	}
+
+	err = sockets.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("expected the socket file to be removed")
+	}
+}
@@ -8,24 +8,49 @@ import (
 	"errors"
 	"fmt"
 	"sync/atomic"
+	"time"
 
 	"github.com/thekhanj/ella/config"
 )
 
-type WatchdogSignal int
+type WatchdogSignalType int
 
 const (
-	WatchdogSigStarted WatchdogSignal = iota
+	WatchdogSigStarted WatchdogSignalType = iota
 	WatchdogSigStopped
 	WatchdogSigFailed
+	// The process has exited after another one has replaced it.
+	WatchdogSigReplaced
+	// The process replacing the running one has exited before becoming
+	// ready, the running one is kept.
+	WatchdogSigRolledBack
 )
 
-var WatchdogErrAlreadyRunning = errors.New("an active process is already running")
+type WatchdogSignal struct {
+	Type WatchdogSignalType
+	// The process the signal is about.
+	Proc *Proc
+	// How the process terminated, only set once it has exited.
+	Exit *ProcExit
+}
+
+var (
+	WatchdogErrAlreadyRunning = errors.New("an active process is already running")
+	WatchdogErrNotRunning     = errors.New("no active process is running")
+	WatchdogErrRolledBack     = errors.New("kept the running process")
+)
 
 type Watchdog interface {
 	Start() (chan WatchdogSignal, error)
 	Stop() error
 	Reload() error
+	// Starts a new process next to the running one, and stops the running
+	// one once the new one has been running for minReady. The running one is
+	// kept when the new one exits before that, WatchdogErrRolledBack is
+	// returned then along with the rolled back signal of the new process.
+	// Otherwise returns the signals of the new process, except for its
+	// started signal.
+	Replace(minReady time.Duration) (chan WatchdogSignal, error)
 	Procs() *Procs
 }
 
@@ -33,10 +58,11 @@ func NewWatchdogFromConfig(
 	cfg config.Watchdog,
 	exec func() (*Proc, error),
 	stop, reload ProcAction,
+	success *ExitStatusSet,
 ) (Watchdog, error) {
 	// TODO: make this watchdog config simpler, no need for this complexity
 	if _, ok := cfg.(*config.SimpleWatchdog); ok {
-		return NewSimpleWatchdog(exec, stop, reload), nil
+		return NewSimpleWatchdog(exec, stop, reload, success), nil
 	} else {
 		return nil, fmt.Errorf("invalid watchdog config: %v", cfg)
 	}
@@ -47,9 +73,14 @@ type SimpleWatchdog struct {
 	exec   func() (*Proc, error)
 	stop   ProcAction
 	reload ProcAction
+	// Exit statuses considered successful besides exit code 0.
+	success *ExitStatusSet
 
 	running atomic.Bool
 	cancel  func()
+	// The process being watched, the processes replaced by it are only
+	// waited for.
+	current atomic.Pointer[Proc]
 }
 
 func (this *SimpleWatchdog) Start() (chan WatchdogSignal, error) {
@@ -62,6 +93,7 @@ func (this *SimpleWatchdog) Start() (chan WatchdogSignal, error) {
 	}
 
 	this.running.Store(true)
+	this.current.Store(proc)
 	go this.procs.Push(proc)
 
 	signals := make(chan WatchdogSignal)
@@ -93,6 +125,80 @@ func (this *SimpleWatchdog) Reload() error {
 	return this.reload.Exec(proc)
 }
 
+func (this *SimpleWatchdog) Replace(
+	minReady time.Duration,
+) (chan WatchdogSignal, error) {
+	old := this.current.Load()
+	if !this.running.Load() || old == nil {
+		return nil, WatchdogErrNotRunning
+	}
+	proc, err := this.exec()
+	if err != nil {
+		return nil, err
+	}
+	// Until the new process takes over, the resources belong to the running
+	// one.
+	proc.Share(true)
+	// Its output is piped before it starts, so none of it gets lost.
+	this.procs.Add(proc)
+
+	signals := make(chan WatchdogSignal)
+	ctx, cancel := context.WithCancel(context.Background())
+	go this.run(ctx, proc, signals)
+
+	exit, err := this.waitReady(signals, minReady)
+	if err != nil {
+		cancel()
+		go func() {
+			for range signals {
+			}
+		}()
+
+		rolledBack := make(chan WatchdogSignal, 1)
+		if exit != nil {
+			rolledBack <- WatchdogSignal{WatchdogSigRolledBack, proc, exit}
+		}
+		close(rolledBack)
+		return rolledBack, fmt.Errorf("%w: %w", WatchdogErrRolledBack, err)
+	}
+
+	old.Share(true)
+	proc.Share(false)
+	oldCancel := this.cancel
+	this.cancel = cancel
+	this.current.Store(proc)
+	this.procs.SetLast(proc)
+	err = this.stop.Exec(old)
+	oldCancel()
+
+	return signals, err
+}
+
+// Returns the exit of the new process when it exits before becoming ready.
+func (this *SimpleWatchdog) waitReady(
+	signals chan WatchdogSignal, minReady time.Duration,
+) (*ProcExit, error) {
+	sig, ok := <-signals
+	if !ok {
+		return nil, errors.New("new process failed to start")
+	}
+	if sig.Type != WatchdogSigStarted {
+		return sig.Exit, fmt.Errorf("new process %s", sig.Exit)
+	}
+
+	select {
+	case sig, ok := <-signals:
+		if !ok {
+			return nil, errors.New("new process stopped")
+		}
+		return sig.Exit, fmt.Errorf(
+			"new process %s before becoming ready", sig.Exit,
+		)
+	case <-time.After(minReady):
+		return nil, nil
+	}
+}
+
 func (this *SimpleWatchdog) Procs() *Procs {
 	return this.procs
 }
@@ -102,10 +208,14 @@ func (this *SimpleWatchdog) run(
 	proc *Proc, signals chan WatchdogSignal,
 ) {
 	states := proc.Sub()
+	exited := false
 	defer func() {
 		proc.Unsub(states)
 		close(signals)
-		this.running.Store(false)
+		// Once the exit is signaled another process might have been started.
+		if !exited && this.current.Load() == proc {
+			this.running.Store(false)
+		}
 	}()
 
 	go func() {
@@ -118,23 +228,41 @@ func (this *SimpleWatchdog) run(
 	for state := range states {
 		if state == ProcStateStarted {
 			// TODO: think about coroutine or not
-			this.signal(signals, WatchdogSigStarted)
+			this.signal(signals, WatchdogSignal{WatchdogSigStarted, proc, nil})
 		}
-		if state == ProcStateStopped {
-			code, err := proc.GetExitCode()
+		// Wait for the outputs to get flushed as well, so the whole output of
+		// the process is available when it's reported.
+		if state == ProcStateWaitDone {
+			exit, err := proc.GetExit()
 			if err != nil {
 				panic("unreachable code")
 			}
 
-			if code == 0 || this.running.Load() == false {
-				this.signal(signals, WatchdogSigStopped)
+			exited = true
+			if this.current.Load() != proc {
+				this.signal(signals, WatchdogSignal{WatchdogSigReplaced, proc, &exit})
+				continue
+			}
+
+			stopped := this.isSuccess(&exit) || this.running.Load() == false
+			this.running.Store(false)
+			if stopped {
+				this.signal(signals, WatchdogSignal{WatchdogSigStopped, proc, &exit})
 			} else {
-				this.signal(signals, WatchdogSigFailed)
+				this.signal(signals, WatchdogSignal{WatchdogSigFailed, proc, &exit})
 			}
 		}
 	}
 }
 
+func (this *SimpleWatchdog) isSuccess(exit *ProcExit) bool {
+	if !exit.Signaled() && exit.Code == 0 {
+		return true
+	}
+
+	return this.success != nil && this.success.Match(exit)
+}
+
 func (this *SimpleWatchdog) signal(
 	sigs chan WatchdogSignal, sig WatchdogSignal,
 ) {
@@ -146,13 +274,16 @@ var _ Watchdog = (*SimpleWatchdog)(nil)
 func NewSimpleWatchdog(
 	exec func() (*Proc, error),
 	stop, reload ProcAction,
+	success *ExitStatusSet,
 ) *SimpleWatchdog {
 	return &SimpleWatchdog{
-		procs:  NewProcs(),
-		exec:   exec,
-		stop:   stop,
-		reload: reload,
+		procs:   NewProcs(),
+		exec:    exec,
+		stop:    stop,
+		reload:  reload,
+		success: success,
 
 		running: atomic.Bool{},
+		current: atomic.Pointer[Proc]{},
 	}
 }
@@ -0,0 +1,129 @@
+// MIT License
+// Copyright (c) 2025 Pooyan Khanjankhani
+
+package main
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/thekhanj/ella/config"
+)
+
+func TestSimpleWatchdogReplace(t *testing.T) {
+	args := []string{"sleep", "10"}
+	exec := func() (*Proc, error) {
+		return NewProc(args[0], args[1:]...), nil
+	}
+	w := NewSimpleWatchdog(
+		exec,
+		&StopSignalProcAction{timeout: time.Second, signal: syscall.SIGTERM},
+		&ReloadSignalProcAction{signal: syscall.SIGHUP},
+		nil,
+	)
+	defer w.Procs().Shutdown()
+
+	sigs, err := w.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig := <-sigs; sig.Type != WatchdogSigStarted {
+		t.Fatalf("unexpected signal: %d", sig.Type)
+	}
+	old, _ := w.Procs().Last()
+
+	newSigs, err := w.Replace(100 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig := <-sigs; sig.Type != WatchdogSigReplaced {
+		t.Fatalf("expected the replaced signal, got: %d", sig.Type)
+	}
+	if last, _ := w.Procs().Last(); last == old {
+		t.Fatal("expected the new process to be the last one")
+	}
+
+	args = []string{"false"}
+	current, _ := w.Procs().Last()
+	_, err = w.Replace(100 * time.Millisecond)
+	if err == nil {
+		t.Fatal("expected a failing process not to replace the running one")
+	}
+	if last, _ := w.Procs().Last(); last != current {
+		t.Fatal("expected the running process to be kept")
+	}
+	if current.GetState() != ProcStateStarted {
+		t.Fatal("expected the running process to keep running")
+	}
+
+	err = w.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig := <-newSigs; sig.Type != WatchdogSigStopped {
+		t.Fatalf("expected the stopped signal, got: %d", sig.Type)
+	}
+}
+
+// Returns the signal the watchdog reports once the command exits on its own.
+func runWatchdogExit(
+	t *testing.T, cmd string, success *ExitStatusSet,
+) WatchdogSignal {
+	t.Helper()
+
+	exec := func() (*Proc, error) {
+		return NewProc("/usr/bin/sh", "-c", cmd), nil
+	}
+	w := NewSimpleWatchdog(
+		exec,
+		&StopSignalProcAction{timeout: time.Second, signal: syscall.SIGTERM},
+		&ReloadSignalProcAction{signal: syscall.SIGHUP},
+		success,
+	)
+	defer w.Procs().Shutdown()
+
+	sigs, err := w.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig := <-sigs; sig.Type != WatchdogSigStarted {
+		t.Fatalf("unexpected signal: %d", sig.Type)
+	}
+
+	return <-sigs
+}
+
+func TestSimpleWatchdogSuccessExitStatus(t *testing.T) {
+	success, err := NewExitStatusSetFromConfig(config.ExitStatuses{
+		Codes:   []int{3},
+		Signals: []string{"SIGUSR1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		cmd      string
+		success  *ExitStatusSet
+		expected WatchdogSignalType
+	}{
+		{"exit 0", nil, WatchdogSigStopped},
+		{"exit 3", nil, WatchdogSigFailed},
+		{"exit 3", success, WatchdogSigStopped},
+		{"exit 4", success, WatchdogSigFailed},
+		{"kill -USR1 $$", success, WatchdogSigStopped},
+		{"kill -USR2 $$", success, WatchdogSigFailed},
+	}
+	for _, test := range tests {
+		sig := runWatchdogExit(t, test.cmd, test.success)
+		if sig.Type != test.expected {
+			t.Fatalf(
+				"%s: expected signal %d, got: %d", test.cmd, test.expected, sig.Type,
+			)
+		}
+		if sig.Exit == nil {
+			t.Fatalf("%s: expected the exit to be reported", test.cmd)
+		}
+	}
+}